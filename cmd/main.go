@@ -3,29 +3,66 @@ package main
 import (
 	"chattweiler/internal/bot"
 	"chattweiler/internal/configs"
+	"chattweiler/internal/doctor"
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository"
 	"chattweiler/internal/repository/factory"
 	"chattweiler/internal/utils"
+	"errors"
+	"fmt"
 	_ "github.com/lib/pq"
+	"os"
 )
 
 func main() {
+	// chattweiler doctor - prints a self-check report and exits
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		report := doctor.NewDoctor().Examine()
+		fmt.Print(report)
+		if report.HasFailures() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if utils.GetEnvOrDefault(configs.BotStartupSelfCheck) == "true" {
+		logging.Log.Info("main", "main", "running self-check...")
+		report := doctor.NewDoctor().Examine()
+		if report.HasConfigurationFailures() {
+			logging.Log.Panic("main", "main", errors.New("self-check is failed"), "%s", report)
+		}
+
+		// other failures could be caused by temporary vk or network issues, so the bot starts anyway
+		if report.HasFailures() {
+			logging.Log.Error("main", "main", errors.New("self-check is failed"), "%s", report)
+		} else {
+			logging.Log.Info("main", "main", "%s", report)
+		}
+	}
+
 	logging.Log.Info("main", "main", "preparing bot instance...")
 	logging.Log.Info("main", "main", "creating and checking phrases repository...")
 	phrases := factory.CreatePhraseRepository(factory.CsvYandexObjectStorage)
 
 	var membershipWarnings repository.MembershipWarningRepository
+	var membershipExemptions repository.MembershipExemptionRepository
+	var kickedUsers repository.KickedUserRepository
 	if utils.GetEnvOrDefault(configs.BotFunctionalityMembershipChecking) == "true" {
 		logging.Log.Info("main", "main", "creating and checking membership warnings repository...")
 		membershipWarnings = factory.CreateMembershipWarningRepository(factory.CsvYandexObjectStorage)
+		logging.Log.Info("main", "main", "creating and checking membership exemptions repository...")
+		membershipExemptions = factory.CreateMembershipExemptionRepository(factory.CsvYandexObjectStorage)
+		kickedUsers = factory.CreateKickedUserRepository(factory.CsvYandexObjectStorage)
 	} else {
 		membershipWarnings = nil
+		membershipExemptions = nil
+		kickedUsers = nil
 	}
 
 	logging.Log.Info("main", "main", "creating and checking commands repository...")
 	commands := factory.CreateContentSourceRepository(factory.CsvYandexObjectStorage)
+	contentCursors := factory.CreateContentCursorRepository(factory.CsvYandexObjectStorage)
 
 	logging.Log.Info("main", "main", "creating bot instance...")
-	bot.NewLongPoolingBot(phrases, membershipWarnings, commands).Serve()
+	bot.NewLongPoolingBot(phrases, membershipWarnings, membershipExemptions, kickedUsers, commands, contentCursors).Serve()
 }
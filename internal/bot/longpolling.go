@@ -4,13 +4,16 @@ import (
 	"chattweiler/internal/bot/object"
 	"chattweiler/internal/bot/object/mapper"
 	"chattweiler/internal/configs"
+	"chattweiler/internal/localization"
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository"
 	"chattweiler/internal/repository/model"
+	"chattweiler/internal/roulette"
 	"chattweiler/internal/utils"
 	"chattweiler/internal/vk"
 	"chattweiler/internal/vk/content/service"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
@@ -22,9 +25,15 @@ import (
 
 type LongPoolingBot struct {
 	vkapi       *api.VK
+	outbox      *vk.Outbox
+	profiles    *vk.UserProfileCache
+	locales     *localization.ChatLocales
 	vklp        *vklp.LongPoll
 	vklpwrapper *wrapper.Wrapper
 
+	// picks up phrases of all messages, so the anti-repeat history is shared by them
+	phraseSelector roulette.Selector
+
 	phrasesRepo        repository.PhraseRepository
 	contentCommandRepo repository.CommandsRepository
 
@@ -33,18 +42,24 @@ type LongPoolingBot struct {
 	contentCommandInputChannel chan *object.ContentRequestCommand
 	contentCourier             *service.MediaContentCourier
 
-	welcomeNewMembersFeatureEnabled bool
-	goodbyeMembersFeatureEnabled    bool
-	contentRequestsFeatureEnabled   bool
+	welcomeNewMembersFeatureEnabled  bool
+	goodbyeMembersFeatureEnabled     bool
+	contentRequestsFeatureEnabled    bool
+	membershipCheckingFeatureEnabled bool
 }
 
 func NewLongPoolingBot(
 	phrasesRepo repository.PhraseRepository,
 	membershipWarningsRepo repository.MembershipWarningRepository,
+	membershipExemptionsRepo repository.MembershipExemptionRepository,
+	kickedUsersRepo repository.KickedUserRepository,
 	contentCommandRepo repository.CommandsRepository,
+	contentCursorRepo repository.ContentCursorRepository,
 ) *LongPoolingBot {
 	vkBotToken := utils.MustGetEnv(configs.VkCommunityBotToken)
-	communityVkApi := api.NewVK(vkBotToken)
+	communityRequestPolicy, err := vk.NewRequestPolicy(configs.VkCommunityTokenRequestsPerSecond)
+	panicIfError(err, "NewLongPoolingBot", "vk request policy configurations parsing is failed")
+	communityVkApi := vk.WithRequestPolicy(api.NewVK(vkBotToken), communityRequestPolicy)
 
 	mode := vklp.ReceiveAttachments + vklp.ExtendedEvents
 	lp, err := vklp.NewLongPoll(communityVkApi, mode)
@@ -56,6 +71,45 @@ func NewLongPoolingBot(
 	communityId, err := strconv.ParseInt(utils.MustGetEnv(configs.VkCommunityID), 10, 64)
 	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.VkCommunityID.Key)
 
+	requiredCommunities := []int64{communityId}
+	if rawRequiredCommunities := utils.GetEnvOrDefault(configs.ChatWardenRequiredCommunities); len(rawRequiredCommunities) != 0 {
+		requiredCommunities = nil
+		for _, rawCommunityId := range strings.Split(rawRequiredCommunities, ",") {
+			requiredCommunityId, err := strconv.ParseInt(strings.TrimSpace(rawCommunityId), 10, 64)
+			panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ChatWardenRequiredCommunities.Key)
+			requiredCommunities = append(requiredCommunities, requiredCommunityId)
+		}
+	}
+
+	membershipRule := vk.MembershipRule(utils.GetEnvOrDefault(configs.ChatWardenRequiredCommunitiesRule))
+	if membershipRule != vk.AllCommunitiesRule && membershipRule != vk.AnyCommunityRule {
+		logging.Log.Panic(logPackage, "NewLongPoolingBot", nil, "%s: unknown rule %s, either %s or %s is expected", configs.ChatWardenRequiredCommunitiesRule.Key, membershipRule, vk.AllCommunitiesRule, vk.AnyCommunityRule)
+	}
+
+	exemptCommunityManagers, err := strconv.ParseBool(utils.GetEnvOrDefault(configs.ChatWardenExemptCommunityManagers))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ChatWardenExemptCommunityManagers.Key)
+
+	var reminderPoints []float64
+	if rawReminderPoints := utils.GetEnvOrDefault(configs.ChatWardenMembershipReminderPoints); len(rawReminderPoints) != 0 {
+		for _, rawReminderPoint := range strings.Split(rawReminderPoints, ",") {
+			reminderPoint, err := strconv.ParseFloat(strings.TrimSpace(rawReminderPoint), 64)
+			panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ChatWardenMembershipReminderPoints.Key)
+			if reminderPoint <= 0 || reminderPoint >= 1 {
+				logging.Log.Panic(logPackage, "NewLongPoolingBot", nil, "%s: a reminder point must be between 0 and 1, but got %v", configs.ChatWardenMembershipReminderPoints.Key, reminderPoint)
+			}
+			reminderPoints = append(reminderPoints, reminderPoint)
+		}
+	}
+
+	rejoinGracePeriod, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ChatWardenRejoinGracePeriod))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ChatWardenRejoinGracePeriod.Key)
+
+	membershipCheckingFeatureEnabled, err := strconv.ParseBool(utils.GetEnvOrDefault(configs.BotFunctionalityMembershipChecking))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.BotFunctionalityMembershipChecking.Key)
+
+	wardenDryRun, err := strconv.ParseBool(utils.GetEnvOrDefault(configs.ChatWardenDryRun))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ChatWardenDryRun.Key)
+
 	membershipCheckInterval, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ChatWarderMembershipCheckInterval))
 	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ChatWarderMembershipCheckInterval.Key)
 
@@ -79,23 +133,102 @@ func NewLongPoolingBot(
 	garbageCollectorsCleaningInterval, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ContentGarbageCollectorsCleaningInterval))
 	panicIfError(err, "%s: parsing of env variable is failed", configs.ContentGarbageCollectorsCleaningInterval.Key)
 
-	vkUserApi := api.NewVK(utils.GetEnvOrDefault(configs.VkAdminUserToken))
+	searchCacheExpiration, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ContentSearchCacheExpiration))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ContentSearchCacheExpiration.Key)
+
+	sourceFailureThreshold, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.ContentSourceFailureThreshold), 10, 32)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ContentSourceFailureThreshold.Key)
+
+	sourceCooldownPeriod, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ContentSourceCooldownPeriod))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ContentSourceCooldownPeriod.Key)
+
+	captionTextMaxLength, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.ContentCaptionTextMaxLength), 10, 32)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ContentCaptionTextMaxLength.Key)
+
+	wallFetchWindows, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.ContentWallFetchWindows), 10, 32)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.ContentWallFetchWindows.Key)
+
+	userTokenPool, err := vk.NewUserTokenPool()
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.VkAdminUserTokenParkingPeriod.Key)
+
+	userTokenHealthLogInterval, err := time.ParseDuration(utils.GetEnvOrDefault(configs.VkAdminUserTokenHealthLogInterval))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.VkAdminUserTokenHealthLogInterval.Key)
+	if userTokenHealthLogInterval > 0 && !userTokenPool.IsEmpty() {
+		// run async, the pool is used only through the api client, so its health is logged from the start
+		go userTokenPool.LoopLogHealth(userTokenHealthLogInterval)
+	}
+
+	userRequestPolicy, err := vk.NewRequestPolicy(configs.VkUserTokenRequestsPerSecond)
+	panicIfError(err, "NewLongPoolingBot", "vk request policy configurations parsing is failed")
+	vkUserApi := userTokenPool.NewVK(userRequestPolicy)
 	vklWrapper := vklpwrapper.NewWrapper(lp)
-	membershipChecker := vk.NewChecker(chatId, communityId, membershipCheckInterval, gracePeriod, communityVkApi, phrasesRepo, membershipWarningsRepo)
-	contentCourier := service.NewMediaContentCourier(communityVkApi, vkUserApi, phrasesRepo, contentCommandRepo, contentRequestsInputChannel, garbageCollectorsCleaningInterval)
+
+	outboxPeerSendInterval, err := time.ParseDuration(utils.GetEnvOrDefault(configs.OutboxPeerSendInterval))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.OutboxPeerSendInterval.Key)
+
+	outboxMaxAttempts, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.OutboxMaxAttempts), 10, 32)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.OutboxMaxAttempts.Key)
+
+	outboxRetryBaseBackoff, err := time.ParseDuration(utils.GetEnvOrDefault(configs.OutboxRetryBaseBackoff))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.OutboxRetryBaseBackoff.Key)
+
+	outbox, err := vk.NewOutbox(
+		communityVkApi,
+		outboxPeerSendInterval,
+		int(outboxMaxAttempts),
+		outboxRetryBaseBackoff,
+		utils.GetEnvOrDefault(configs.OutboxPersistenceFile),
+		utils.GetEnvOrDefault(configs.OutboxDeadLettersFile),
+	)
+	panicIfError(err, "NewLongPoolingBot", "outbox initialization error")
+
+	antiRepeatHistorySize, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.PhrasesAntiRepeatHistorySize), 10, 32)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.PhrasesAntiRepeatHistorySize.Key)
+
+	antiRepeatWeightFactor, err := strconv.ParseFloat(utils.GetEnvOrDefault(configs.PhrasesAntiRepeatWeightFactor), 64)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.PhrasesAntiRepeatWeightFactor.Key)
+
+	// phrases are picked up only by their weights if the anti-repeat history is disabled
+	var phraseSelector roulette.Selector = roulette.SpinSelector{}
+	if antiRepeatHistorySize > 0 {
+		phraseSelector = roulette.NewAntiRepeatSelector(int(antiRepeatHistorySize), antiRepeatWeightFactor)
+	}
+
+	userProfilesCacheTTL, err := time.ParseDuration(utils.GetEnvOrDefault(configs.UserProfilesCacheTTL))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.UserProfilesCacheTTL.Key)
+
+	userProfilesCacheMaxSize, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.UserProfilesCacheMaxSize), 10, 32)
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.UserProfilesCacheMaxSize.Key)
+
+	chatLocales, err := localization.ParseChatLocales(utils.GetEnvOrDefault(configs.PhrasesChatLocales))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.PhrasesChatLocales.Key)
+
+	phrasesLocation, err := time.LoadLocation(utils.GetEnvOrDefault(configs.PhrasesTimeZone))
+	panicIfError(err, "NewLongPoolingBot", "%s: parsing of env variable is failed", configs.PhrasesTimeZone.Key)
+
+	locales := localization.NewChatLocales(utils.GetEnvOrDefault(configs.PhrasesDefaultLocale), chatLocales, phrasesLocation)
+	profiles := vk.NewUserProfileCache(communityVkApi, userProfilesCacheTTL, int(userProfilesCacheMaxSize))
+	membershipChecker := vk.NewChecker(chatId, requiredCommunities, membershipRule, membershipCheckInterval, gracePeriod, communityVkApi, outbox, profiles, locales, phraseSelector, phrasesRepo, membershipWarningsRepo, membershipExemptionsRepo, kickedUsersRepo, exemptCommunityManagers, reminderPoints, rejoinGracePeriod, wardenDryRun)
+	sourcesHealth := service.NewContentSourceHealthTracker(int(sourceFailureThreshold), sourceCooldownPeriod)
+	contentCourier := service.NewMediaContentCourier(communityVkApi, vkUserApi, outbox, profiles, locales, phraseSelector, phrasesRepo, contentCommandRepo, contentCursorRepo, contentRequestsInputChannel, garbageCollectorsCleaningInterval, searchCacheExpiration, sourcesHealth, int(captionTextMaxLength), int(wallFetchWindows))
 
 	return &LongPoolingBot{
-		vkapi:                           communityVkApi,
-		vklp:                            lp,
-		vklpwrapper:                     vklWrapper,
-		phrasesRepo:                     phrasesRepo,
-		contentCommandRepo:              contentCommandRepo,
-		membershipChecker:               membershipChecker,
-		contentCourier:                  contentCourier,
-		contentCommandInputChannel:      contentRequestsInputChannel,
-		welcomeNewMembersFeatureEnabled: welcomeNewMembersFeatureEnabled,
-		goodbyeMembersFeatureEnabled:    goodbyeMembersFeatureEnabled,
-		contentRequestsFeatureEnabled:   contentRequestsFeatureEnabled,
+		vkapi:                            communityVkApi,
+		outbox:                           outbox,
+		profiles:                         profiles,
+		locales:                          locales,
+		phraseSelector:                   phraseSelector,
+		vklp:                             lp,
+		vklpwrapper:                      vklWrapper,
+		phrasesRepo:                      phrasesRepo,
+		contentCommandRepo:               contentCommandRepo,
+		membershipChecker:                membershipChecker,
+		contentCourier:                   contentCourier,
+		contentCommandInputChannel:       contentRequestsInputChannel,
+		welcomeNewMembersFeatureEnabled:  welcomeNewMembersFeatureEnabled,
+		goodbyeMembersFeatureEnabled:     goodbyeMembersFeatureEnabled,
+		contentRequestsFeatureEnabled:    contentRequestsFeatureEnabled,
+		membershipCheckingFeatureEnabled: membershipCheckingFeatureEnabled,
 	}
 }
 
@@ -103,7 +236,7 @@ func (bot *LongPoolingBot) Serve() {
 	bot.vklpwrapper.OnChatInfoChange(func(event wrapper.ChatInfoChange) {
 		switch resolveChatInfoChangeEventType(event) {
 		case vklpwrapper.ChatUserCome:
-			if bot.welcomeNewMembersFeatureEnabled {
+			if bot.welcomeNewMembersFeatureEnabled || bot.membershipCheckingFeatureEnabled {
 				bot.handleChatUserJoinEvent(mapper.NewChatEventFromFromChatInfoChange(event))
 			}
 		case vklpwrapper.ChatUserLeave:
@@ -113,13 +246,16 @@ func (bot *LongPoolingBot) Serve() {
 		}
 	})
 
+	// run async, messages which are left after a restart are delivered first
+	bot.outbox.Start()
+
 	if bot.contentRequestsFeatureEnabled {
 		// run async
 		go bot.contentCourier.ReceiveAndDeliver()
 	}
 
 	bot.vklpwrapper.OnNewMessage(func(event wrapper.NewMessage) {
-		command := bot.contentCommandRepo.FindByCommandAlias(event.Text)
+		command, query := bot.findCommand(event.Text)
 		if command == nil {
 			return
 		}
@@ -129,7 +265,7 @@ func (bot *LongPoolingBot) Serve() {
 			bot.handleInfoCommand(mapper.NewChatEventFromNewMessage(event))
 		case model.ContentCommand:
 			if bot.contentRequestsFeatureEnabled {
-				bot.handleContentRequestCommand(mapper.NewContentCommandRequest(command, event))
+				bot.handleContentRequestCommand(mapper.NewContentCommandRequest(command, query, event))
 			}
 		}
 	})
@@ -142,59 +278,92 @@ func (bot *LongPoolingBot) Serve() {
 	panicIfError(err, "LongPoolingBot.Serve", "bot is crashed")
 }
 
+// findCommand finds a command by the whole message text, or by its beginning
+// if the rest of it is a query for a command with search (e.g. "pic cats")
+func (bot *LongPoolingBot) findCommand(text string) (*model.Command, string) {
+	command := bot.contentCommandRepo.FindByCommandAlias(text)
+	if command != nil {
+		return command, ""
+	}
+
+	words := strings.Fields(text)
+	for aliasLength := len(words) - 1; aliasLength > 0; aliasLength-- {
+		command = bot.contentCommandRepo.FindByCommandAlias(strings.Join(words[:aliasLength], " "))
+		if command == nil {
+			continue
+		}
+
+		if command.Type == model.ContentCommand && command.ContentDescriptor.SearchEnabled {
+			return command, strings.Join(words[aliasLength:], " ")
+		}
+		return nil, ""
+	}
+
+	return nil, ""
+}
+
 func (bot *LongPoolingBot) handleChatUserJoinEvent(event *object.ChatEvent) {
-	user, err := vk.GetUserInfo(bot.vkapi, event.UserID)
+	user, err := bot.profiles.Get(event.UserID)
 	if err != nil {
 		logging.Log.Error(logPackage, "LongPoolingBot.handleChatUserJoinEvent", err, "message sending error")
 		return
 	}
 
 	logging.Log.Info(logPackage, "LongPoolingBot.handleChatUserJoinEvent", "'%s' user is joined", user.ScreenName)
-	phrases := bot.phrasesRepo.FindAllByType(model.WelcomeType)
+	if bot.membershipCheckingFeatureEnabled && bot.membershipChecker.CheckRejoinedUser(event.PeerID, user) {
+		logging.Log.Info(logPackage, "LongPoolingBot.handleChatUserJoinEvent", "'%s' user is removed after rejoining without subscription", user.ScreenName)
+		return
+	}
+
+	if !bot.welcomeNewMembersFeatureEnabled {
+		return
+	}
+
+	phrases := bot.phrasesRepo.FindAllByType(model.WelcomeType, bot.locales.GetChatLocale(event.PeerID))
 	if len(phrases) == 0 {
 		logging.Log.Warn(logPackage, "LongPoolingBot.handleChatUserJoinEvent", "there's no welcome phrases, message won't be sent")
 		return
 	}
 
-	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(event.PeerID, user, phrases)
-	_, err = bot.vkapi.MessagesSend(messageToSend)
+	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(bot.phraseSelector, event.PeerID, user, phrases, vk.NewPhraseData(bot.vkapi, bot.locales, event.PeerID))
+	err = bot.outbox.Enqueue(messageToSend)
 	if err != nil {
-		logging.Log.Error(logPackage, "LongPoolingBot.handleChatUserJoinEvent", err, "message sending error")
+		logging.Log.Error(logPackage, "LongPoolingBot.handleChatUserJoinEvent", err, "message enqueuing error. Params: %v", messageToSend)
 	}
 }
 
 func (bot *LongPoolingBot) handleChatUserLeavingEvent(event *object.ChatEvent) {
-	user, err := vk.GetUserInfo(bot.vkapi, event.UserID)
+	user, err := bot.profiles.Get(event.UserID)
 	if err != nil {
 		logging.Log.Error(logPackage, "LongPoolingBot.handleChatUserLeavingEvent", err, "vk api error")
 		return
 	}
 
 	logging.Log.Info(logPackage, "LongPoolingBot.handleChatUserLeavingEvent", "'%s' user is gone", user.ScreenName)
-	phrases := bot.phrasesRepo.FindAllByType(model.GoodbyeType)
+	phrases := bot.phrasesRepo.FindAllByType(model.GoodbyeType, bot.locales.GetChatLocale(event.PeerID))
 	if len(phrases) == 0 {
 		logging.Log.Warn(logPackage, "LongPoolingBot.handleChatUserJoinEvent", "there's no goodbye phrases, message won't be sent")
 		return
 	}
 
-	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(event.PeerID, user, phrases)
-	_, err = bot.vkapi.MessagesSend(messageToSend)
+	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(bot.phraseSelector, event.PeerID, user, phrases, vk.NewPhraseData(bot.vkapi, bot.locales, event.PeerID))
+	err = bot.outbox.Enqueue(messageToSend)
 	if err != nil {
-		logging.Log.Error(logPackage, "LongPoolingBot.handleChatUserLeavingEvent", err, "message sending error. Sent params: %v", messageToSend)
+		logging.Log.Error(logPackage, "LongPoolingBot.handleChatUserLeavingEvent", err, "message enqueuing error. Params: %v", messageToSend)
 	}
 }
 
 func (bot *LongPoolingBot) handleInfoCommand(event *object.ChatEvent) {
-	phrases := bot.phrasesRepo.FindAllByType(model.InfoType)
+	phrases := bot.phrasesRepo.FindAllByType(model.InfoType, bot.locales.GetChatLocale(event.PeerID))
 	if len(phrases) == 0 {
 		logging.Log.Warn(logPackage, "LongPoolingBot.handleInfoCommand", "there's no info phrases, message won't be sent")
 		return
 	}
 
-	messageToSend := vk.BuildMessageWithRandomPhrase(event.PeerID, phrases)
-	_, err := bot.vkapi.MessagesSend(messageToSend)
+	messageToSend := vk.BuildMessageWithRandomPhrase(bot.phraseSelector, event.PeerID, phrases, vk.NewPhraseData(bot.vkapi, bot.locales, event.PeerID))
+	err := bot.outbox.Enqueue(messageToSend)
 	if err != nil {
-		logging.Log.Error(logPackage, "LongPoolingBot.handleInfoCommand", err, "message sending error. Sent params: %v", messageToSend)
+		logging.Log.Error(logPackage, "LongPoolingBot.handleInfoCommand", err, "message enqueuing error. Params: %v", messageToSend)
 	}
 }
 
@@ -203,12 +372,7 @@ func (bot *LongPoolingBot) handleContentRequestCommand(request *object.ContentRe
 }
 
 func (bot *LongPoolingBot) startMembershipCheckingAsync() {
-	checkMembershipFeatureEnabled, err := strconv.ParseBool(utils.GetEnvOrDefault(configs.BotFunctionalityMembershipChecking))
-	if err != nil {
-		logging.Log.Panic(logPackage, "LongPoolingBot.startMembershipCheckingAsync", err, "%s: parsing of env variable is failed", configs.BotFunctionalityMembershipChecking.Key)
-	}
-
-	if checkMembershipFeatureEnabled {
+	if bot.membershipCheckingFeatureEnabled {
 		go bot.membershipChecker.LoopCheck()
 	}
 }
@@ -21,12 +21,13 @@ func NewChatEventFromNewMessage(message wrapper.NewMessage) *object.ChatEvent {
 	}
 }
 
-func NewContentCommandRequest(command *model.Command, message wrapper.NewMessage) *object.ContentRequestCommand {
+func NewContentCommandRequest(command *model.Command, query string, message wrapper.NewMessage) *object.ContentRequestCommand {
 	return &object.ContentRequestCommand{
 		Command: command,
 		Event: &object.ChatEvent{
 			UserID: message.AdditionalData.From,
 			PeerID: message.PeerID,
 		},
+		Query: query,
 	}
 }
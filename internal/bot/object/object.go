@@ -13,6 +13,9 @@ type ChatEvent struct {
 type ContentRequestCommand struct {
 	Command *model.Command
 	Event   *ChatEvent
+
+	// free-text query passed after command's alias, empty if there's no one
+	Query string
 }
 
 func (request *ContentRequestCommand) GetAttachmentsTypes() []vk.MediaAttachmentType {
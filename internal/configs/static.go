@@ -4,7 +4,15 @@ package configs
 VkCommunityBotToken a specific token for your community (e.g. "956c94e96...6039be4e")
 VkCommunityID a specific community id (e.g. "161...464")
 VkCommunityChatID a particular chat in your community (e.g. either 1 or 2 or more)
-VkAdminUserToken
+VkAdminUserToken a user token which is used for content fetching
+VkAdminUserTokens several user tokens separated by comma, they're rotated along with VkAdminUserToken
+VkAdminUserTokenParkingPeriod a period for which a rate-limited user token is taken out of rotation
+VkAdminUserTokenHealthLogInterval a periodic interval of logging states of user tokens, zero disables it
+VkCommunityTokenRequestsPerSecond a max number of api calls per second by the community token
+VkUserTokenRequestsPerSecond a max number of api calls per second by each user token
+VkRequestMaxRetries a max number of repeated api calls after transient errors (too many requests, flood control, internal server error)
+VkRequestRetryBaseBackoff a backoff before the first repeated api call, it's doubled for every next one
+VkRequestTimeout a deadline for an api call with all its retries
 
 Configurations for VK-API interactions
 */
@@ -12,31 +20,79 @@ var VkCommunityBotToken = NewMandatoryConfig("vk.community.bot.token")
 var VkCommunityID = NewMandatoryConfig("vk.community.id")
 var VkCommunityChatID = NewMandatoryConfig("vk.community.chat.id")
 var VkAdminUserToken = NewOptionalConfig("vk.admin.user.token", "")
+var VkAdminUserTokens = NewOptionalConfig("vk.admin.user.tokens", "")
+var VkAdminUserTokenParkingPeriod = NewOptionalConfig("vk.admin.user.token.parking.period", "1h")
+var VkAdminUserTokenHealthLogInterval = NewOptionalConfig("vk.admin.user.token.health.log.interval", "1h")
+var VkCommunityTokenRequestsPerSecond = NewOptionalConfig("vk.community.token.requests.per.second", "20")
+var VkUserTokenRequestsPerSecond = NewOptionalConfig("vk.user.token.requests.per.second", "3")
+var VkRequestMaxRetries = NewOptionalConfig("vk.request.max.retries", "3")
+var VkRequestRetryBaseBackoff = NewOptionalConfig("vk.request.retry.base.backoff", "200ms")
+var VkRequestTimeout = NewOptionalConfig("vk.request.timeout", "30s")
 
 /*
 ChatWarderMembershipCheckInterval a periodic interval after which the application goes to VK-API to compare actual members in a chat
 ChatWardenMembershipGracePeriod a period after which the application checks if a warned user subscribed to a community
+ChatWardenMembershipReminderPoints fractions of a grace period separated by comma after which warned users are reminded
+ChatWardenRejoinGracePeriod a grace period for a kicked user who rejoined a chat without subscription, zero means he's removed immediately
+ChatWardenDryRun runs membership checking without sending messages, kicking users and saving warnings, all of that is only logged
+ChatWardenRequiredCommunities community ids separated by comma which membership is required in a chat, the bot's community by default
+ChatWardenRequiredCommunitiesRule either "all" or "any", whether a user has to be a member of every required community or at least one of them
+ChatWardenExemptCommunityManagers exempts managers (admins, editors, moderators) of required communities from membership checking
+ChatWardenExemptionsCacheRefreshInterval a periodic interval after which the application invalidates its cache with membership exemptions
+ChatWardenKickedUsersCacheRefreshInterval a periodic interval after which the application invalidates its cache with kicked users
 ChatUseFirstNameInsteadUsername either uses actual name of a user or his url-uid for communication (e.g. "John" or "john_2001")
 
 Configurations for the chat functionality
 */
 var ChatWarderMembershipCheckInterval = NewOptionalConfig("chat.warden.membership.check.interval", "10m")
 var ChatWardenMembershipGracePeriod = NewOptionalConfig("chat.warden.membership.grace.period", "1h")
+var ChatWardenMembershipReminderPoints = NewOptionalConfig("chat.warden.membership.reminder.points", "0.5,0.9")
+var ChatWardenRejoinGracePeriod = NewOptionalConfig("chat.warden.rejoin.grace.period", "0s")
+var ChatWardenDryRun = NewOptionalConfig("chat.warden.dry.run", "false")
+var ChatWardenRequiredCommunities = NewOptionalConfig("chat.warden.required.communities", "")
+var ChatWardenRequiredCommunitiesRule = NewOptionalConfig("chat.warden.required.communities.rule", "all")
+var ChatWardenExemptCommunityManagers = NewOptionalConfig("chat.warden.exempt.community.managers", "false")
+var ChatWardenExemptionsCacheRefreshInterval = NewOptionalConfig("chat.warden.exemptions.cache.refresh.interval", "15m")
+var ChatWardenKickedUsersCacheRefreshInterval = NewOptionalConfig("chat.warden.kicked.users.cache.refresh.interval", "15m")
 var ChatUseFirstNameInsteadUsername = NewOptionalConfig("chat.use.first.name.instead.username", "false")
 
 /*
 ContentCommandCacheRefreshInterval a periodic interval after which the application invalidates its cache with commands
 ContentRequestsQueueSize a buffered channel size between event handler and command executors
 ContentGarbageCollectorsCleaningInterval a periodic interval after which the application removes already unused content collectors which are cached
+ContentSearchCacheExpiration a period during which found content for a command's query is cached
+ContentSourceFailureThreshold a number of failures in a row after which a content source is temporarily excluded
+ContentSourceCooldownPeriod a period during which a failed content source is excluded
+ContentCaptionTextMaxLength a max length of a source post's text in a caption of delivered content
+ContentWallFetchWindows a number of 100 posts' windows fetched from a wall by one api call per cache refresh (max 24)
 
 Configurations for content commands` logic
 */
 var ContentCommandCacheRefreshInterval = NewOptionalConfig("content.command.cache.refresh.interval", "15m")
 var ContentRequestsQueueSize = NewOptionalConfig("content.requests.queue.size", "100")
 var ContentGarbageCollectorsCleaningInterval = NewOptionalConfig("content.garbage.collectors.cleaning.interval", "10m")
+var ContentSearchCacheExpiration = NewOptionalConfig("content.search.cache.expiration", "30m")
+var ContentSourceFailureThreshold = NewOptionalConfig("content.source.failure.threshold", "3")
+var ContentSourceCooldownPeriod = NewOptionalConfig("content.source.cooldown.period", "10m")
+var ContentCaptionTextMaxLength = NewOptionalConfig("content.caption.text.max.length", "200")
+var ContentWallFetchWindows = NewOptionalConfig("content.wall.fetch.windows", "10")
 
-// PhrasesCacheRefreshInterval a periodic interval after which the application invalidates its cache with phrases
+/*
+PhrasesCacheRefreshInterval a periodic interval after which the application invalidates its cache with phrases
+PhrasesDefaultLocale a locale of phrases without a locale and of chats without a specified one
+PhrasesChatLocales locales of chats separated by comma (e.g. "1:ru,2:en", where 1 and 2 are chat ids)
+PhrasesTimeZone a time zone of phrases' active hours, weekdays and dates (e.g. "Europe/Moscow")
+PhrasesAntiRepeatHistorySize a number of the last picked up phrases of a type in a chat which are less likely to be repeated, zero disables it
+PhrasesAntiRepeatWeightFactor a factor of weights of recently picked up phrases, zero excludes them while there're other phrases
+
+Configurations for phrases
+*/
 var PhrasesCacheRefreshInterval = NewOptionalConfig("phrases.cache.refresh.interval", "15m")
+var PhrasesDefaultLocale = NewOptionalConfig("phrases.default.locale", "en")
+var PhrasesChatLocales = NewOptionalConfig("phrases.chat.locales", "")
+var PhrasesTimeZone = NewOptionalConfig("phrases.time.zone", "UTC")
+var PhrasesAntiRepeatHistorySize = NewOptionalConfig("phrases.anti.repeat.history.size", "0")
+var PhrasesAntiRepeatWeightFactor = NewOptionalConfig("phrases.anti.repeat.weight.factor", "0.1")
 
 // ContentAudioMaxCachedAttachments a max number of content that could be stored in an application's cache
 // ContentAudioCacheRefreshThreshold a threshold for a cache with content after which the cache fills out by new content
@@ -53,12 +109,18 @@ var ContentPictureCacheRefreshThreshold = NewOptionalConfig("content.picture.cac
 var ContentVideoMaxCachedAttachments = NewOptionalConfig("content.video.max.cached.attachments", "100")
 var ContentVideoCacheRefreshThreshold = NewOptionalConfig("content.video.cache.refresh.threshold", "0.2")
 
+// ContentDocumentMaxCachedAttachments a max number of content that could be stored in an application's cache
+// ContentDocumentCacheRefreshThreshold a threshold for a cache with content after which the cache fills out by new content
+var ContentDocumentMaxCachedAttachments = NewOptionalConfig("content.document.max.cached.attachments", "100")
+var ContentDocumentCacheRefreshThreshold = NewOptionalConfig("content.document.cache.refresh.threshold", "0.2")
+
 /*
 BotFunctionalityWelcomeNewMembers enables welcome functionality
 BotFunctionalityGoodbyeMembers enables goodbye functionality
 BotFunctionalityMembershipChecking enables membership checking functionality
 BotFunctionalityContentCommands enables requesting of media content functionality
 BotLogToFile enables writing of a log file near an execution file
+BotStartupSelfCheck enables checking of tokens and their permissions at startup
 
 General application configurations
 */
@@ -67,6 +129,27 @@ var BotFunctionalityGoodbyeMembers = NewOptionalConfig("bot.functionality.goodby
 var BotFunctionalityMembershipChecking = NewOptionalConfig("bot.functionality.membership.checking", "false")
 var BotFunctionalityContentCommands = NewOptionalConfig("bot.functionality.content.commands", "false")
 var BotLogToFile = NewOptionalConfig("bot.log.file", "false")
+var BotStartupSelfCheck = NewOptionalConfig("bot.startup.self.check", "true")
+
+// UserProfilesCacheTTL a period during which a fetched user profile is cached
+// UserProfilesCacheMaxSize a max number of cached user profiles, the least recently used ones are evicted
+var UserProfilesCacheTTL = NewOptionalConfig("user.profiles.cache.ttl", "1h")
+var UserProfilesCacheMaxSize = NewOptionalConfig("user.profiles.cache.max.size", "10000")
+
+/*
+OutboxPeerSendInterval a min interval between messages to the same chat
+OutboxMaxAttempts a max number of attempts to send a message after network errors before it goes to the dead letters
+OutboxRetryBaseBackoff a backoff before the second attempt to send a message, it's doubled for every next one
+OutboxPersistenceFile (optional) a file where pending messages are saved, so they're sent after a restart
+OutboxDeadLettersFile (optional) a file where undelivered messages are appended, they're logged anyway
+
+Configurations for outgoing messages
+*/
+var OutboxPeerSendInterval = NewOptionalConfig("outbox.peer.send.interval", "500ms")
+var OutboxMaxAttempts = NewOptionalConfig("outbox.max.attempts", "5")
+var OutboxRetryBaseBackoff = NewOptionalConfig("outbox.retry.base.backoff", "1s")
+var OutboxPersistenceFile = NewOptionalConfig("outbox.persistence.file", "")
+var OutboxDeadLettersFile = NewOptionalConfig("outbox.dead.letters.file", "")
 
 /*
 YandexObjectStorageAccessKeyID
@@ -76,7 +159,11 @@ YandexObjectStoragePhrasesBucket
 YandexObjectStoragePhrasesBucketKey
 YandexObjectStorageContentSourceBucket
 YandexObjectStorageContentSourceBucketKey
+YandexObjectStorageContentCursorsBucketKey a key of a file with positions of sequential commands in the content command bucket
 YandexObjectStorageMembershipWarningBucket
+YandexObjectStorageMembershipKickedUsersBucketKey a key of a file with kicked users in the membership warning bucket
+YandexObjectStorageMembershipExemptionBucket (optional) a bucket with users who are exempted from membership checking
+YandexObjectStorageMembershipExemptionBucketKey (optional)
 
 https://cloud.yandex.com/en-ru/services/storage
 Yandex S3 object storage configurations
@@ -88,4 +175,8 @@ var YandexObjectStoragePhrasesBucket = NewMandatoryConfig("yandex.object.storage
 var YandexObjectStoragePhrasesBucketKey = NewMandatoryConfig("yandex.object.storage.phrases.bucket.key")
 var YandexObjectStorageContentSourceBucket = NewMandatoryConfig("yandex.object.storage.content.command.bucket")
 var YandexObjectStorageContentSourceBucketKey = NewMandatoryConfig("yandex.object.storage.content.command.bucket.key")
+var YandexObjectStorageContentCursorsBucketKey = NewOptionalConfig("yandex.object.storage.content.command.cursors.bucket.key", "content_cursors.csv")
 var YandexObjectStorageMembershipWarningBucket = NewMandatoryConfig("yandex.object.storage.membership.warning.bucket")
+var YandexObjectStorageMembershipKickedUsersBucketKey = NewOptionalConfig("yandex.object.storage.membership.kicked.users.bucket.key", "kicked_users.csv")
+var YandexObjectStorageMembershipExemptionBucket = NewOptionalConfig("yandex.object.storage.membership.exemption.bucket", "")
+var YandexObjectStorageMembershipExemptionBucketKey = NewOptionalConfig("yandex.object.storage.membership.exemption.bucket.key", "")
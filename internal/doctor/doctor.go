@@ -0,0 +1,320 @@
+package doctor
+
+import (
+	"chattweiler/internal/configs"
+	"chattweiler/internal/localization"
+	"chattweiler/internal/utils"
+	"chattweiler/internal/vk"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type CheckStatus string
+
+const (
+	PassedStatus  CheckStatus = "OK"
+	WarningStatus CheckStatus = "WARNING"
+	FailedStatus  CheckStatus = "FAILED"
+	SkippedStatus CheckStatus = "SKIPPED"
+)
+
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Details string
+	// a configuration couldn't be parsed, so the application can't start at all
+	IsConfiguration bool
+}
+
+type Report struct {
+	Results []CheckResult
+}
+
+func (report *Report) add(name string, status CheckStatus, detailsFormat string, args ...interface{}) {
+	report.Results = append(report.Results, CheckResult{
+		Name:    name,
+		Status:  status,
+		Details: fmt.Sprintf(detailsFormat, args...),
+	})
+}
+
+func (report *Report) HasFailures() bool {
+	for _, result := range report.Results {
+		if result.Status == FailedStatus {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasConfigurationFailures tells whether any configuration couldn't be parsed,
+// other failures could be caused by temporary vk or network issues
+func (report *Report) HasConfigurationFailures() bool {
+	for _, result := range report.Results {
+		if result.Status == FailedStatus && result.IsConfiguration {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (report *Report) String() string {
+	var builder strings.Builder
+	builder.WriteString("self-check report:\n")
+	for _, result := range report.Results {
+		builder.WriteString(fmt.Sprintf("  %-9s %s: %s\n", "["+string(result.Status)+"]", result.Name, result.Details))
+	}
+
+	return builder.String()
+}
+
+// Doctor checks that the given tokens have enough permissions for the enabled functionality,
+// so misconfiguration is found at startup instead of the first runtime call
+type Doctor struct {
+	communityVkApi *api.VK
+	userVkApi      *api.VK
+	userTokenPool  *vk.TokenPool
+
+	// https://dev.vk.com/method/messages.getConversationsById
+	// conversationId = 2000000000 + id, id - chat id
+	chatId      int64
+	communityId int64
+
+	membershipCheckingEnabled bool
+	contentCommandsEnabled    bool
+
+	// configurations which couldn't be parsed
+	configurationErrors []CheckResult
+}
+
+// NewDoctor creates a doctor from configurations, unparsable values are reported as failed checks
+func NewDoctor() *Doctor {
+	doctor := &Doctor{}
+	communityRequestPolicy := doctor.parseRequestPolicy(configs.VkCommunityTokenRequestsPerSecond)
+	userRequestPolicy := doctor.parseRequestPolicy(configs.VkUserTokenRequestsPerSecond)
+	doctor.communityVkApi = vk.WithRequestPolicy(api.NewVK(doctor.getEnv(configs.VkCommunityBotToken)), communityRequestPolicy)
+	doctor.chatId = doctor.parseInt(configs.VkCommunityChatID)
+	doctor.communityId = doctor.parseInt(configs.VkCommunityID)
+	doctor.membershipCheckingEnabled = doctor.parseBool(configs.BotFunctionalityMembershipChecking)
+	doctor.contentCommandsEnabled = doctor.parseBool(configs.BotFunctionalityContentCommands)
+	doctor.checkPhrasesLocalization()
+
+	userTokenPool, err := vk.NewUserTokenPool()
+	if err != nil {
+		doctor.addConfigurationError(configs.VkAdminUserTokenParkingPeriod, err)
+		userTokenPool = vk.NewTokenPool(nil, 0)
+	}
+	doctor.userTokenPool = userTokenPool
+	doctor.userVkApi = userTokenPool.NewVK(userRequestPolicy)
+
+	return doctor
+}
+
+func (doctor *Doctor) getEnv(config configs.ApplicationConfig) string {
+	if _, isMandatory := config.(*configs.MandatoryConfig); isMandatory && len(os.Getenv(config.GetKey())) == 0 {
+		doctor.addConfigurationError(config, errors.New("variable must be specified"))
+		return ""
+	}
+
+	return utils.GetEnvOrDefault(config)
+}
+
+func (doctor *Doctor) parseInt(config configs.ApplicationConfig) int64 {
+	rawValue := doctor.getEnv(config)
+	if len(rawValue) == 0 {
+		return 0
+	}
+
+	value, err := strconv.ParseInt(rawValue, 10, 64)
+	if err != nil {
+		doctor.addConfigurationError(config, err)
+	}
+
+	return value
+}
+
+func (doctor *Doctor) parseBool(config configs.ApplicationConfig) bool {
+	value, err := strconv.ParseBool(doctor.getEnv(config))
+	if err != nil {
+		doctor.addConfigurationError(config, err)
+	}
+
+	return value
+}
+
+// checkPhrasesLocalization checks locales of chats and the time zone, which are parsed when the bot is created
+func (doctor *Doctor) checkPhrasesLocalization() {
+	_, err := localization.ParseChatLocales(doctor.getEnv(configs.PhrasesChatLocales))
+	if err != nil {
+		doctor.addConfigurationError(configs.PhrasesChatLocales, err)
+	}
+
+	_, err = time.LoadLocation(doctor.getEnv(configs.PhrasesTimeZone))
+	if err != nil {
+		doctor.addConfigurationError(configs.PhrasesTimeZone, err)
+	}
+}
+
+func (doctor *Doctor) parseRequestPolicy(requestsPerSecondConfig configs.ApplicationConfig) vk.RequestPolicy {
+	policy, err := vk.NewRequestPolicy(requestsPerSecondConfig)
+	if err != nil {
+		doctor.addConfigurationError(requestsPerSecondConfig, err)
+	}
+
+	return policy
+}
+
+func (doctor *Doctor) addConfigurationError(config configs.ApplicationConfig, err error) {
+	doctor.configurationErrors = append(doctor.configurationErrors, CheckResult{
+		Name:            "configuration " + config.GetKey(),
+		Status:          FailedStatus,
+		Details:         err.Error(),
+		IsConfiguration: true,
+	})
+}
+
+// Examine runs checks of the enabled functionality, a check which depends on a failed one is skipped
+func (doctor *Doctor) Examine() *Report {
+	report := &Report{}
+	report.Results = append(report.Results, doctor.configurationErrors...)
+	if len(doctor.configurationErrors) != 0 {
+		return report
+	}
+
+	if doctor.checkCommunityToken(report) {
+		if doctor.checkChatAccess(report) {
+			doctor.checkKickPermission(report)
+		} else {
+			report.add("kick permission", SkippedStatus, "chat isn't accessible")
+		}
+	} else {
+		report.add("chat access", SkippedStatus, "community token is invalid")
+		report.add("kick permission", SkippedStatus, "community token is invalid")
+	}
+
+	doctor.checkUserTokens(report)
+	return report
+}
+
+func (doctor *Doctor) checkCommunityToken(report *Report) bool {
+	const name = "community token"
+	communities, err := doctor.communityVkApi.GroupsGetByID(api.Params{})
+	if err != nil {
+		report.add(name, FailedStatus, "%s is rejected: %v", configs.VkCommunityBotToken.Key, err)
+		return false
+	}
+
+	if len(communities) == 0 || int64(communities[0].ID) != doctor.communityId {
+		report.add(name, FailedStatus, "the token doesn't belong to the community %d (%s)", doctor.communityId, configs.VkCommunityID.Key)
+		return false
+	}
+
+	report.add(name, PassedStatus, "the token belongs to \"%s\"", communities[0].Name)
+	return true
+}
+
+func (doctor *Doctor) checkChatAccess(report *Report) bool {
+	const name = "chat access"
+	conversations, err := doctor.communityVkApi.MessagesGetConversationsByID(api.Params{
+		"peer_ids": 2000000000 + doctor.chatId,
+	})
+	if err != nil {
+		report.add(name, FailedStatus, "messages aren't accessible by the community token: %v", err)
+		return false
+	}
+
+	if conversations.Count == 0 {
+		report.add(name, FailedStatus, "the bot isn't in the chat %d (%s)", doctor.chatId, configs.VkCommunityChatID.Key)
+		return false
+	}
+
+	report.add(name, PassedStatus, "the bot is in the chat \"%s\"", conversations.Items[0].ChatSettings.Title)
+	return true
+}
+
+func (doctor *Doctor) checkKickPermission(report *Report) {
+	const name = "kick permission"
+	if !doctor.membershipCheckingEnabled {
+		report.add(name, SkippedStatus, "membership checking is disabled")
+		return
+	}
+
+	// members of a chat are available only for its admins
+	members, err := vk.GetAllConversationMembers(doctor.communityVkApi, 2000000000+doctor.chatId)
+	if vk.ClassifyError(err) == vk.AccessDeniedErrorKind {
+		report.add(name, FailedStatus, "chat members aren't accessible, the bot has to be an admin of the chat: %v", err)
+		return
+	}
+
+	if err != nil {
+		report.add(name, FailedStatus, "chat members aren't accessible: %v", err)
+		return
+	}
+
+	for _, member := range members.Items {
+		if int64(member.MemberID) == -doctor.communityId {
+			if member.IsAdmin || member.IsOwner {
+				report.add(name, PassedStatus, "the bot is an admin of the chat")
+				return
+			}
+			break
+		}
+	}
+
+	report.add(name, FailedStatus, "the bot has to be an admin of the chat to kick its members")
+}
+
+func (doctor *Doctor) checkUserTokens(report *Report) {
+	if !doctor.contentCommandsEnabled {
+		report.add("user token wall access", SkippedStatus, "content commands are disabled")
+		report.add("user token audio access", SkippedStatus, "content commands are disabled")
+		return
+	}
+
+	if doctor.userTokenPool.IsEmpty() {
+		report.add("user token wall access", FailedStatus, "neither %s nor %s is specified", configs.VkAdminUserToken.Key, configs.VkAdminUserTokens.Key)
+		report.add("user token audio access", SkippedStatus, "there's no user token")
+		return
+	}
+
+	// tokens are rotated, so every token of the pool is tried once
+	var err error
+	for range doctor.userTokenPool.Health() {
+		_, err = doctor.userVkApi.WallGet(api.Params{
+			"owner_id": -doctor.communityId,
+			"count":    1,
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		report.add("user token wall access", FailedStatus, "wall.get is failed: %v", err)
+	} else {
+		report.add("user token wall access", PassedStatus, "wall.get is available")
+	}
+
+	// audio is used by playlist sources and audio commands only, so it's not critical
+	_, err = vk.AudioGet(doctor.userVkApi, api.Params{
+		"count": 1,
+	})
+	if err != nil {
+		report.add("user token audio access", WarningStatus, "audio.get is failed, audio content won't be delivered: %v", err)
+	} else {
+		report.add("user token audio access", PassedStatus, "audio.get is available")
+	}
+
+	for _, health := range doctor.userTokenPool.Health() {
+		if health.Invalidated {
+			report.add("user token "+health.Token, FailedStatus, "the token is invalidated: %v", health.LastError)
+		}
+	}
+}
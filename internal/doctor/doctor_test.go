@@ -0,0 +1,52 @@
+package doctor
+
+import (
+	"chattweiler/internal/configs"
+	"testing"
+)
+
+func TestReportHasConfigurationFailures(t *testing.T) {
+	report := &Report{}
+	report.add("community token", FailedStatus, "token is rejected")
+	if !report.HasFailures() {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", false, true)
+	}
+	if report.HasConfigurationFailures() {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", true, false)
+	}
+
+	report.Results = append(report.Results, CheckResult{Name: "configuration key", Status: FailedStatus, IsConfiguration: true})
+	if !report.HasConfigurationFailures() {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", false, true)
+	}
+}
+
+func TestExamineReportsOnlyConfigurationErrors(t *testing.T) {
+	t.Setenv(configs.VkCommunityBotToken.Key, "token")
+	t.Setenv(configs.VkCommunityID.Key, "1")
+	t.Setenv(configs.VkCommunityChatID.Key, "not a number")
+
+	report := NewDoctor().Examine()
+	if len(report.Results) != 1 {
+		t.Fatalf("Incorrect result. Actual: %v, Expected: %v", len(report.Results), 1)
+	}
+
+	result := report.Results[0]
+	expectedName := "configuration " + configs.VkCommunityChatID.Key
+	if result.Name != expectedName || result.Status != FailedStatus || !result.IsConfiguration {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", result, expectedName)
+	}
+}
+
+func TestExamineReportsInvalidPhrasesLocalization(t *testing.T) {
+	t.Setenv(configs.VkCommunityBotToken.Key, "token")
+	t.Setenv(configs.VkCommunityID.Key, "1")
+	t.Setenv(configs.VkCommunityChatID.Key, "1")
+	t.Setenv(configs.PhrasesChatLocales.Key, "1")
+	t.Setenv(configs.PhrasesTimeZone.Key, "Mars/Olympus")
+
+	report := NewDoctor().Examine()
+	if !report.HasConfigurationFailures() || len(report.Results) != 2 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", report, "failed phrases.chat.locales and phrases.time.zone")
+	}
+}
@@ -0,0 +1,131 @@
+package localization
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// time zones are embedded, since they could be missing in a container
+	_ "time/tzdata"
+)
+
+// ChatLocales locales of chats, phrases and built-in texts for a chat are picked up in its locale
+type ChatLocales struct {
+	defaultLocale string
+	// locales by peer ids (2000000000 + chat id)
+	chatLocales map[int]string
+	// a time zone of phrases' schedules and time placeholders
+	location *time.Location
+}
+
+func NewChatLocales(defaultLocale string, chatLocales map[int]string, location *time.Location) *ChatLocales {
+	return &ChatLocales{
+		defaultLocale: NormalizeLocale(defaultLocale),
+		chatLocales:   chatLocales,
+		location:      location,
+	}
+}
+
+// ParseChatLocales parses locales of chats separated by comma (e.g. "1:ru,2:en", where 1 and 2 are chat ids)
+func ParseChatLocales(raw string) (map[int]string, error) {
+	chatLocales := make(map[int]string)
+	if len(strings.TrimSpace(raw)) == 0 {
+		return chatLocales, nil
+	}
+
+	for _, rawChatLocale := range strings.Split(raw, ",") {
+		rawChatId, locale, found := strings.Cut(strings.TrimSpace(rawChatLocale), ":")
+		if !found || len(strings.TrimSpace(locale)) == 0 {
+			return nil, fmt.Errorf("chat locale '%s' must be in <chat_id>:<locale> format", rawChatLocale)
+		}
+
+		chatId, err := strconv.Atoi(strings.TrimSpace(rawChatId))
+		if err != nil {
+			return nil, fmt.Errorf("chat locale '%s' has invalid chat id: %w", rawChatLocale, err)
+		}
+
+		chatLocales[2000000000+chatId] = NormalizeLocale(locale)
+	}
+
+	return chatLocales, nil
+}
+
+func NormalizeLocale(locale string) string {
+	return strings.ToLower(strings.TrimSpace(locale))
+}
+
+func (locales *ChatLocales) Default() string {
+	return locales.defaultLocale
+}
+
+func (locales *ChatLocales) Location() *time.Location {
+	return locales.location
+}
+
+// GetChatLocale returns a locale of a chat, the default one if it's not specified for the chat
+func (locales *ChatLocales) GetChatLocale(peerId int) string {
+	if locale, exists := locales.chatLocales[peerId]; exists {
+		return locale
+	}
+	return locales.defaultLocale
+}
+
+// GetTextLocales returns locales which built-in texts of a chat are looked up in: the chat locale, then the default one
+func (locales *ChatLocales) GetTextLocales(peerId int) []string {
+	return []string{locales.GetChatLocale(peerId), locales.defaultLocale}
+}
+
+// TextKey a built-in text which is used in messages along with phrases
+type TextKey string
+
+const (
+	// ListConjunctionText a conjunction before the last item of a list (e.g. "@john, @anna and @mary")
+	ListConjunctionText TextKey = "list_conjunction"
+	// AlternativesSeparatorText a separator of communities which a user could subscribe to one of
+	AlternativesSeparatorText TextKey = "alternatives_separator"
+	// MorningText, AfternoonText, EveningText and NightText values of the time of day placeholder
+	MorningText   TextKey = "morning"
+	AfternoonText TextKey = "afternoon"
+	EveningText   TextKey = "evening"
+	NightText     TextKey = "night"
+)
+
+const fallbackLocale = "en"
+
+var texts = map[string]map[TextKey]string{
+	"en": {
+		ListConjunctionText:       " and ",
+		AlternativesSeparatorText: " or ",
+		MorningText:               "morning",
+		AfternoonText:             "afternoon",
+		EveningText:               "evening",
+		NightText:                 "night",
+	},
+	"ru": {
+		ListConjunctionText:       " и ",
+		AlternativesSeparatorText: " или ",
+		MorningText:               "утро",
+		AfternoonText:             "день",
+		EveningText:               "вечер",
+		NightText:                 "ночь",
+	},
+}
+
+// Text returns a built-in text in the first locale which has it, english is used if none of them has it
+func Text(key TextKey, locales ...string) string {
+	for _, candidate := range append(locales, fallbackLocale) {
+		if text, exists := texts[candidate][key]; exists {
+			return text
+		}
+	}
+	return ""
+}
+
+// JoinList joins items by comma and the localized conjunction before the last one (e.g. "@john, @anna and @mary")
+func JoinList(items []string, locales ...string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + Text(ListConjunctionText, locales...) + items[len(items)-1]
+}
@@ -0,0 +1,49 @@
+package localization
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseChatLocales(t *testing.T) {
+	chatLocales, err := ParseChatLocales(" 1:RU, 2:en ")
+	if err != nil || len(chatLocales) != 2 || chatLocales[2000000001] != "ru" || chatLocales[2000000002] != "en" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", chatLocales, map[int]string{2000000001: "ru", 2000000002: "en"})
+	}
+
+	for _, raw := range []string{"1", "1:", "chat:ru"} {
+		_, err := ParseChatLocales(raw)
+		if err == nil {
+			t.Errorf("Incorrect result for %s. Actual: %v, Expected: an error", raw, err)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	if actual := Text(AlternativesSeparatorText, "ru"); actual != " или " {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, " или ")
+	}
+
+	if actual := Text(AlternativesSeparatorText, "de"); actual != " or " {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, " or ")
+	}
+
+	// a chat locale without built-in texts falls back to the default locale
+	locales := NewChatLocales("RU", map[int]string{2000000001: "de"}, time.UTC)
+	if actual := Text(MorningText, locales.GetTextLocales(2000000001)...); actual != "утро" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, "утро")
+	}
+}
+
+func TestJoinList(t *testing.T) {
+	for expected, items := range map[string][]string{
+		"":                     nil,
+		"@john":                {"@john"},
+		"@john и @anna":        {"@john", "@anna"},
+		"@john, @anna и @mary": {"@john", "@anna", "@mary"},
+	} {
+		if actual := JoinList(items, "ru"); actual != expected {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package factory
 
 import (
 	"chattweiler/internal/configs"
+	"chattweiler/internal/localization"
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository"
 	"chattweiler/internal/repository/storage"
@@ -82,11 +83,23 @@ func createCsvObjectStorageCachedPhraseRepository() *storage.CsvObjectStorageCac
 		)
 	}
 
+	location, err := time.LoadLocation(utils.GetEnvOrDefault(configs.PhrasesTimeZone))
+	if err != nil {
+		logging.Log.Panic(
+			logPackage,
+			"CsvObjectStorageCachedPhraseRepository.createCsvObjectStorageCachedPhraseRepository",
+			err,
+			configs.PhrasesTimeZone.Key+": parsing of env variable is failed",
+		)
+	}
+
 	return storage.NewCsvObjectStorageCachedPhraseRepository(
 		getObjectStorageClient(),
 		utils.MustGetEnv(configs.YandexObjectStoragePhrasesBucket),
 		utils.MustGetEnv(configs.YandexObjectStoragePhrasesBucketKey),
 		cacheRefreshInterval,
+		localization.NormalizeLocale(utils.GetEnvOrDefault(configs.PhrasesDefaultLocale)),
+		location,
 	)
 }
 
@@ -139,3 +152,90 @@ func createCsvObjectStorageMembershipWarningRepository() *storage.CsvObjectStora
 		utils.MustGetEnv(configs.YandexObjectStorageMembershipWarningBucket),
 	)
 }
+
+// CreateMembershipExemptionRepository creates a repository with exempted users, or returns nil if it's not configured
+func CreateMembershipExemptionRepository(repoType StorageType) repository.MembershipExemptionRepository {
+	if len(utils.GetEnvOrDefault(configs.YandexObjectStorageMembershipExemptionBucket)) == 0 {
+		return nil
+	}
+
+	var repo repository.MembershipExemptionRepository
+	switch repoType {
+	case CsvYandexObjectStorage:
+		fallthrough
+	default:
+		repo = createCsvObjectStorageCachedMembershipExemptionRepository()
+	}
+
+	return repo
+}
+
+func createCsvObjectStorageCachedMembershipExemptionRepository() *storage.CsvObjectStorageCachedMembershipExemptionRepository {
+	cacheRefreshInterval, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ChatWardenExemptionsCacheRefreshInterval))
+	if err != nil {
+		logging.Log.Panic(
+			logPackage,
+			"CsvObjectStorageCachedMembershipExemptionRepository.createCsvObjectStorageCachedMembershipExemptionRepository",
+			err,
+			configs.ChatWardenExemptionsCacheRefreshInterval.Key+": parsing of env variable is failed",
+		)
+	}
+
+	return storage.NewCsvObjectStorageCachedMembershipExemptionRepository(
+		getObjectStorageClient(),
+		utils.GetEnvOrDefault(configs.YandexObjectStorageMembershipExemptionBucket),
+		utils.GetEnvOrDefault(configs.YandexObjectStorageMembershipExemptionBucketKey),
+		cacheRefreshInterval,
+	)
+}
+
+func CreateKickedUserRepository(repoType StorageType) repository.KickedUserRepository {
+	var repo repository.KickedUserRepository
+	switch repoType {
+	case CsvYandexObjectStorage:
+		fallthrough
+	default:
+		repo = createCsvObjectStorageCachedKickedUserRepository()
+	}
+
+	return repo
+}
+
+func createCsvObjectStorageCachedKickedUserRepository() *storage.CsvObjectStorageCachedKickedUserRepository {
+	cacheRefreshInterval, err := time.ParseDuration(utils.GetEnvOrDefault(configs.ChatWardenKickedUsersCacheRefreshInterval))
+	if err != nil {
+		logging.Log.Panic(
+			logPackage,
+			"CsvObjectStorageCachedKickedUserRepository.createCsvObjectStorageCachedKickedUserRepository",
+			err,
+			configs.ChatWardenKickedUsersCacheRefreshInterval.Key+": parsing of env variable is failed",
+		)
+	}
+
+	return storage.NewCsvObjectStorageCachedKickedUserRepository(
+		getObjectStorageClient(),
+		utils.MustGetEnv(configs.YandexObjectStorageMembershipWarningBucket),
+		utils.GetEnvOrDefault(configs.YandexObjectStorageMembershipKickedUsersBucketKey),
+		cacheRefreshInterval,
+	)
+}
+
+func CreateContentCursorRepository(repoType StorageType) repository.ContentCursorRepository {
+	var repo repository.ContentCursorRepository
+	switch repoType {
+	case CsvYandexObjectStorage:
+		fallthrough
+	default:
+		repo = createCsvObjectStorageContentCursorRepository()
+	}
+
+	return repo
+}
+
+func createCsvObjectStorageContentCursorRepository() *storage.CsvObjectStorageContentCursorRepository {
+	return storage.NewCsvObjectStorageContentCursorRepository(
+		getObjectStorageClient(),
+		utils.MustGetEnv(configs.YandexObjectStorageContentSourceBucket),
+		utils.GetEnvOrDefault(configs.YandexObjectStorageContentCursorsBucketKey),
+	)
+}
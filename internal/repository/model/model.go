@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,12 +14,24 @@ type Phrase struct {
 	VkAudioId  string     `csv:"vk_audio_id"`
 	VkGifId    string     `csv:"vk_gif_id"`
 	Text       string     `csv:"text"`
+	// empty value means the default locale
+	Locale string `csv:"locale,omitempty"`
+	// hours when a phrase is active in "HH:MM-HH:MM" format, a range could go over midnight (e.g. "22:00-06:00")
+	ActiveHours string `csv:"active_hours,omitempty"`
+	// weekdays when a phrase is active separated by comma (e.g. "sat,sun")
+	ActiveWeekdays string `csv:"active_weekdays,omitempty"`
+	// yearly dates when a phrase is active in "MM-DD..MM-DD" format, a range could go over new year (e.g. "12-25..01-07")
+	ActiveDates string `csv:"active_dates,omitempty"`
 }
 
 func (p Phrase) UserTemplated() bool {
 	return strings.Contains(p.Text, "%username%")
 }
 
+func (p Phrase) UsersTemplated() bool {
+	return strings.Contains(p.Text, "%usernames%")
+}
+
 func (p Phrase) HasAudioAccompaniment() bool {
 	id := strings.TrimSpace(p.VkAudioId)
 	return id != "" && !strings.EqualFold(id, "null")
@@ -28,6 +42,142 @@ func (p Phrase) HasGifAccompaniment() bool {
 	return id != "" && !strings.EqualFold(id, "null")
 }
 
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// PhraseSchedule parsed active hours, weekdays and dates of a phrase, empty ones aren't checked
+type PhraseSchedule struct {
+	// minutes of a day [from, to), a range could go over midnight
+	hours *[2]int
+	// nil means any weekday
+	weekdays map[time.Weekday]bool
+	// month*100+day [from, to), a range could go over new year
+	dates *[2]int
+}
+
+// ValidateSchedule checks active hours, weekdays and dates of a phrase
+func (p Phrase) ValidateSchedule() error {
+	_, err := p.ParseSchedule()
+	return err
+}
+
+// ParseSchedule parses every field of a phrase's schedule, so an invalid one is found regardless of the current time
+func (p Phrase) ParseSchedule() (PhraseSchedule, error) {
+	var schedule PhraseSchedule
+	if len(strings.TrimSpace(p.ActiveHours)) != 0 {
+		from, to, err := parseRange(p.ActiveHours, "-", "15:04")
+		if err != nil {
+			return PhraseSchedule{}, fmt.Errorf("active hours '%s' must be in HH:MM-HH:MM format", p.ActiveHours)
+		}
+		schedule.hours = &[2]int{from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute()}
+	}
+
+	if len(strings.TrimSpace(p.ActiveWeekdays)) != 0 {
+		schedule.weekdays = make(map[time.Weekday]bool)
+		for _, rawWeekday := range strings.Split(p.ActiveWeekdays, ",") {
+			weekday, exists := weekdays[strings.ToLower(strings.TrimSpace(rawWeekday))]
+			if !exists {
+				return PhraseSchedule{}, fmt.Errorf("active weekday '%s' is unknown, one of mon, tue, wed, thu, fri, sat, sun is expected", rawWeekday)
+			}
+			schedule.weekdays[weekday] = true
+		}
+	}
+
+	if len(strings.TrimSpace(p.ActiveDates)) != 0 {
+		from, to, err := parseRange(p.ActiveDates, "..", "01-02")
+		if err != nil {
+			return PhraseSchedule{}, fmt.Errorf("active dates '%s' must be in MM-DD..MM-DD format", p.ActiveDates)
+		}
+		schedule.dates = &[2]int{int(from.Month())*100 + from.Day(), int(to.Month())*100 + to.Day() + 1}
+	}
+
+	return schedule, nil
+}
+
+// IsActive tells whether a phrase is active at the moment, a phrase without a schedule is always active
+func (p Phrase) IsActive(now time.Time) (bool, error) {
+	schedule, err := p.ParseSchedule()
+	if err != nil {
+		return false, err
+	}
+	return schedule.IsActive(now), nil
+}
+
+// IsActive tells whether all the conditions of a schedule match the moment
+func (schedule PhraseSchedule) IsActive(now time.Time) bool {
+	if schedule.hours != nil && !isInCyclicRange(now.Hour()*60+now.Minute(), schedule.hours[0], schedule.hours[1]) {
+		return false
+	}
+
+	if schedule.weekdays != nil && !schedule.weekdays[now.Weekday()] {
+		return false
+	}
+
+	if schedule.dates != nil && !isInCyclicRange(int(now.Month())*100+now.Day(), schedule.dates[0], schedule.dates[1]) {
+		return false
+	}
+
+	return true
+}
+
+func parseRange(raw, separator, layout string) (time.Time, time.Time, error) {
+	rawFrom, rawTo, found := strings.Cut(strings.TrimSpace(raw), separator)
+	if !found {
+		return time.Time{}, time.Time{}, fmt.Errorf("range '%s' has no separator '%s'", raw, separator)
+	}
+
+	from, err := time.Parse(layout, strings.TrimSpace(rawFrom))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to, err := time.Parse(layout, strings.TrimSpace(rawTo))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return from, to, nil
+}
+
+// isInCyclicRange tells whether a value is in [from, to), the range goes over the cycle's end if from > to
+func isInCyclicRange(value, from, to int) bool {
+	if from <= to {
+		return value >= from && value < to
+	}
+	return value >= from || value < to
+}
+
+// SelectPhrasesByLocale picks up phrases in a locale, if there's no ones, phrases in the default locale,
+// and if there's no such ones too, any phrases. Phrases without a locale are treated as phrases in the default locale
+func SelectPhrasesByLocale(phrases []Phrase, locale, defaultLocale string) []Phrase {
+	for _, candidate := range []string{locale, defaultLocale} {
+		var selected []Phrase
+		for _, phrase := range phrases {
+			phraseLocale := strings.ToLower(strings.TrimSpace(phrase.Locale))
+			if len(phraseLocale) == 0 {
+				phraseLocale = defaultLocale
+			}
+
+			if phraseLocale == candidate {
+				selected = append(selected, phrase)
+			}
+		}
+
+		if len(selected) != 0 {
+			return selected
+		}
+	}
+
+	return phrases
+}
+
 type MembershipWarning struct {
 	WarningID      int       `csv:"warning_id"`
 	UserID         int       `csv:"user_id"`
@@ -35,6 +185,35 @@ type MembershipWarning struct {
 	FirstWarningTs time.Time `csv:"first_warning_ts"`
 	GracePeriod    string    `csv:"grace_period"`
 	IsRelevant     bool      `csv:"is_relevant"`
+	// a number of reminders which are already sent, so they aren't repeated after restarts
+	RemindersSent int `csv:"reminders_sent,omitempty"`
+}
+
+// KickedUser a user who was removed from chat for missing membership,
+// such user isn't given a full grace period again until he subscribes
+type KickedUser struct {
+	UserID   int       `csv:"user_id"`
+	Username string    `csv:"username"`
+	KickedTs time.Time `csv:"kicked_ts"`
+}
+
+// ContentCursor a position of the next post to deliver from the oldest one on a wall in sequential mode
+type ContentCursor struct {
+	CommandID int    `csv:"command_id"`
+	Source    string `csv:"source"`
+	Position  int    `csv:"position"`
+}
+
+// MembershipExemption a user who is never warned or kicked for missing membership (e.g. partner bots, guests)
+type MembershipExemption struct {
+	UserID int    `csv:"user_id"`
+	Reason string `csv:"reason"`
+	// empty value means the exemption never expires
+	ExpiresAt time.Time `csv:"expires_at,omitempty"`
+}
+
+func (exemption MembershipExemption) IsActive(now time.Time) bool {
+	return exemption.ExpiresAt.IsZero() || now.Before(exemption.ExpiresAt)
 }
 
 // CsvCommand storage specific object of Command
@@ -44,6 +223,18 @@ type CsvCommand struct {
 	Type              CommandType `csv:"command_type"`
 	MediaContentTypes string      `csv:"media_types"`
 	CommunityIDs      string      `csv:"community_ids"`
+	DocExtensions     string      `csv:"doc_extensions"`
+	MinLikes          int         `csv:"min_likes,omitempty"`
+	MinReposts        int         `csv:"min_reposts,omitempty"`
+	MinViews          int         `csv:"min_views,omitempty"`
+	MaxPostAge        string      `csv:"max_post_age"`
+	ExcludePinned     bool        `csv:"exclude_pinned,omitempty"`
+	ExcludeAds        bool        `csv:"exclude_ads,omitempty"`
+	TextBlocklist     string      `csv:"text_blocklist"`
+	SearchEnabled     bool        `csv:"search_enabled,omitempty"`
+	CaptionTemplate   string      `csv:"caption_template"`
+	Mode              ContentMode `csv:"mode"`
+	TopWindow         string      `csv:"top_window"`
 }
 
 // Command domain object
@@ -62,16 +253,146 @@ type ContentDescriptor struct {
 	// media content type which command supposed to deliver on call
 	MediaContentType []MediaContentType
 
-	// communities that are able for command to use as content sources
-	CommunitySourceIDs []string
+	// walls, albums and playlists that are able for command to use as content sources
+	ContentSources []ContentSource
+
+	// document extensions which are allowed for doc content (e.g. "gif", "pdf"), any if empty
+	DocumentExtensions []string
+
+	// restrictions for wall posts which content is picked up from
+	PostFilter PostFilter
+
+	// allows to call command with a free-text query to search content (e.g. "pic cats")
+	SearchEnabled bool
+
+	// appended under delivered content if specified (e.g. "%community_name%: %post_url%")
+	CaptionTemplate string
+
+	// how content is picked up from sources, random by default
+	Mode ContentMode
+
+	// a period which the most liked posts are picked up from in top mode
+	TopWindow time.Duration
+}
+
+// PostFilter wall posts' restrictions, zero values mean no restriction
+type PostFilter struct {
+	MinLikes   int
+	MinReposts int
+	MinViews   int
+
+	// posts which are older than that are skipped (e.g. posts for the last 30 days)
+	MaxPostAge time.Duration
+
+	ExcludePinned bool
+	ExcludeAds    bool
+
+	// posts which text contains any of these words are skipped (case-insensitive)
+	TextBlocklist []string
+}
+
+// IsDocumentExtensionAllowed tells whether a document with such extension could be delivered
+func (descriptor ContentDescriptor) IsDocumentExtensionAllowed(extension string) bool {
+	if len(descriptor.DocumentExtensions) == 0 {
+		return true
+	}
+
+	for _, allowedExtension := range descriptor.DocumentExtensions {
+		if strings.EqualFold(allowedExtension, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContentSource a place where content is fetched from
+type ContentSource struct {
+	Kind ContentSourceKind
+
+	// community domain or id for wall sources (e.g. "jazzjazz")
+	Domain string
+
+	// owner and album of album or playlist sources (e.g. -123 and 456 for "album:-123_456")
+	OwnerID int
+	AlbumID string
+
+	// used for probability of the source to be picked up among others, 1 by default
+	Weight int
+}
+
+// ParseContentSource parses a source declared in commands file.
+// A value without a kind prefix is treated as a community wall (e.g. "jazzjazz"),
+// other kinds are declared as "<kind>:<owner_id>_<album_id>" (e.g. "album:-123_456").
+// Any source could have a weight suffix (e.g. "jazzjazz*3")
+func ParseContentSource(raw string) (ContentSource, error) {
+	raw = strings.TrimSpace(raw)
+	declaration, rawWeight, hasWeight := strings.Cut(raw, "*")
+	weight := 1
+	if hasWeight {
+		var err error
+		weight, err = strconv.Atoi(rawWeight)
+		if err != nil || weight < 0 {
+			return ContentSource{}, fmt.Errorf("content source '%s' has invalid weight", raw)
+		}
+	}
+
+	source, err := parseContentSourceDeclaration(declaration)
+	if err != nil {
+		return ContentSource{}, err
+	}
+
+	source.Weight = weight
+	return source, nil
+}
+
+func parseContentSourceDeclaration(raw string) (ContentSource, error) {
+	kind, value, hasKind := strings.Cut(raw, ":")
+	if !hasKind {
+		kind, value = string(WallSource), raw
+	}
+
+	if len(value) == 0 {
+		return ContentSource{}, fmt.Errorf("content source '%s' is empty", raw)
+	}
+
+	switch ContentSourceKind(kind) {
+	case WallSource:
+		return ContentSource{Kind: WallSource, Domain: value}, nil
+	case PhotoAlbumSource, VideoAlbumSource, AudioPlaylistSource:
+		separatorIndex := strings.LastIndex(value, "_")
+		if separatorIndex <= 0 || separatorIndex == len(value)-1 {
+			return ContentSource{}, fmt.Errorf("content source '%s' must be in <owner_id>_<album_id> format", raw)
+		}
+
+		ownerID, err := strconv.Atoi(value[:separatorIndex])
+		if err != nil {
+			return ContentSource{}, fmt.Errorf("content source '%s' has invalid owner id: %w", raw, err)
+		}
+
+		return ContentSource{
+			Kind:    ContentSourceKind(kind),
+			OwnerID: ownerID,
+			AlbumID: value[separatorIndex+1:],
+		}, nil
+	}
+
+	return ContentSource{}, fmt.Errorf("content source '%s' has unknown kind '%s'", raw, kind)
+}
+
+func (source ContentSource) String() string {
+	if source.Kind == WallSource {
+		return source.Domain
+	}
+
+	return fmt.Sprintf("%s:%d_%s", source.Kind, source.OwnerID, source.AlbumID)
 }
 
 func NewCommand(
 	id int,
 	commandType CommandType,
 	commands []string,
-	mediaContentType []MediaContentType,
-	communityIDs []string,
+	contentDescriptor ContentDescriptor,
 ) Command {
 	var command Command
 
@@ -81,10 +402,7 @@ func NewCommand(
 
 	switch commandType {
 	case ContentCommand:
-		command.ContentDescriptor = ContentDescriptor{
-			MediaContentType:   mediaContentType,
-			CommunitySourceIDs: communityIDs,
-		}
+		command.ContentDescriptor = contentDescriptor
 	}
 
 	return command
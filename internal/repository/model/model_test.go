@@ -0,0 +1,167 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseWallContentSource(t *testing.T) {
+	source, err := ParseContentSource("jazzjazz")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := ContentSource{Kind: WallSource, Domain: "jazzjazz", Weight: 1}
+	if source != expected {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", source, expected)
+	}
+}
+
+func TestParseAlbumContentSource(t *testing.T) {
+	source, err := ParseContentSource("album:-123_456")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := ContentSource{Kind: PhotoAlbumSource, OwnerID: -123, AlbumID: "456", Weight: 1}
+	if source != expected {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", source, expected)
+	}
+}
+
+func TestParseWeightedContentSource(t *testing.T) {
+	source, err := ParseContentSource("video:-123_456*3")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := ContentSource{Kind: VideoAlbumSource, OwnerID: -123, AlbumID: "456", Weight: 3}
+	if source != expected {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", source, expected)
+	}
+}
+
+func TestParseInvalidContentSource(t *testing.T) {
+	for _, raw := range []string{"", "album:-123", "album:abc_456", "unknown:-123_456", "jazzjazz*x", "jazzjazz*-1"} {
+		if _, err := ParseContentSource(raw); err == nil {
+			t.Errorf("Expected error for '%s'", raw)
+		}
+	}
+}
+
+func TestMembershipExemptionIsActive(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		exemption MembershipExemption
+		expected  bool
+	}{
+		{MembershipExemption{UserID: 1}, true},
+		{MembershipExemption{UserID: 1, ExpiresAt: now.Add(time.Hour)}, true},
+		{MembershipExemption{UserID: 1, ExpiresAt: now.Add(-time.Hour)}, false},
+	}
+
+	for _, test := range tests {
+		actual := test.exemption.IsActive(now)
+		if actual != test.expected {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, test.expected)
+		}
+	}
+}
+
+func TestSelectPhrasesByLocale(t *testing.T) {
+	phrases := []Phrase{
+		{PhraseID: 1, Locale: "ru"},
+		{PhraseID: 2, Locale: ""},
+		{PhraseID: 3, Locale: "EN"},
+		{PhraseID: 4, Locale: "de"},
+	}
+
+	for locale, expected := range map[string][]int{"ru": {1}, "en": {2, 3}, "fr": {2, 3}} {
+		selected := SelectPhrasesByLocale(phrases, locale, "en")
+		var actual []int
+		for _, phrase := range selected {
+			actual = append(actual, phrase.PhraseID)
+		}
+
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Errorf("Incorrect result for %s. Actual: %v, Expected: %v", locale, actual, expected)
+		}
+	}
+
+	actual := SelectPhrasesByLocale(phrases[3:], "ru", "en")
+	if len(actual) != 1 || actual[0].PhraseID != 4 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, phrases[3:])
+	}
+}
+
+func TestPhraseIsActive(t *testing.T) {
+	// Saturday
+	now := time.Date(2022, 12, 31, 23, 30, 0, 0, time.UTC)
+
+	for phrase, expected := range map[Phrase]bool{
+		{}:                            true,
+		{ActiveHours: "22:00-06:00"}:  true,
+		{ActiveHours: "09:00-18:00"}:  false,
+		{ActiveWeekdays: "sat, sun"}:  true,
+		{ActiveWeekdays: "mon,tue"}:   false,
+		{ActiveDates: "12-25..01-07"}: true,
+		{ActiveDates: "12-31..12-31"}: true,
+		{ActiveDates: "03-08..03-08"}: false,
+		{ActiveHours: "22:00-06:00", ActiveWeekdays: "fri", ActiveDates: "12-25..01-07"}: false,
+	} {
+		actual, err := phrase.IsActive(now)
+		if err != nil || actual != expected {
+			t.Errorf("Incorrect result for %+v. Actual: %v, Expected: %v", phrase, actual, expected)
+		}
+	}
+
+	for _, phrase := range []Phrase{{ActiveHours: "22-6"}, {ActiveWeekdays: "saturday"}, {ActiveDates: "12-25"}} {
+		if err := phrase.ValidateSchedule(); err == nil {
+			t.Errorf("Incorrect result for %+v. Actual: %v, Expected: an error", phrase, err)
+		}
+	}
+}
+
+func TestPhraseValidateScheduleChecksEveryField(t *testing.T) {
+	phrase := Phrase{ActiveHours: "09:00-10:00", ActiveWeekdays: "saturday"}
+
+	// the hours don't match, but the invalid weekday has to be found anyway
+	_, err := phrase.IsActive(time.Date(2022, 12, 31, 23, 30, 0, 0, time.UTC))
+	if err == nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: an error", err)
+	}
+
+	if err := phrase.ValidateSchedule(); err == nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: an error", err)
+	}
+
+	phrase = Phrase{ActiveHours: "09:00-10:00", ActiveDates: "12-25"}
+	if err := phrase.ValidateSchedule(); err == nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: an error", err)
+	}
+}
+
+func TestIsDocumentExtensionAllowed(t *testing.T) {
+	tests := []struct {
+		allowedExtensions []string
+		extension         string
+		expected          bool
+	}{
+		{nil, "gif", true},
+		{[]string{}, "pdf", true},
+		{[]string{"gif", "pdf"}, "pdf", true},
+		{[]string{"gif", "pdf"}, "PDF", true},
+		{[]string{"GIF"}, "gif", true},
+		{[]string{"gif", "pdf"}, "zip", false},
+		{[]string{"gif"}, "", false},
+	}
+
+	for _, test := range tests {
+		descriptor := ContentDescriptor{DocumentExtensions: test.allowedExtensions}
+		actual := descriptor.IsDocumentExtensionAllowed(test.extension)
+		if actual != test.expected {
+			t.Errorf("Incorrect result for %v and '%s'. Actual: %v, Expected: %v", test.allowedExtensions, test.extension, actual, test.expected)
+		}
+	}
+}
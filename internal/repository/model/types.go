@@ -3,12 +3,17 @@ package model
 type PhraseType string
 
 const (
-	WelcomeType           PhraseType = "welcome"
-	GoodbyeType           PhraseType = "goodbye"
-	MembershipWarningType PhraseType = "membership_warning"
-	InfoType              PhraseType = "info"
-	ContentRequestType    PhraseType = "content_request"
-	RetryType             PhraseType = "retry_request"
+	WelcomeType                 PhraseType = "welcome"
+	GoodbyeType                 PhraseType = "goodbye"
+	MembershipWarningType       PhraseType = "membership_warning"
+	MembershipWarningPluralType PhraseType = "membership_warning_plural"
+	MembershipReminderType      PhraseType = "membership_reminder"
+	MembershipKickType          PhraseType = "membership_kick"
+	MembershipRejoinType        PhraseType = "membership_rejoin"
+	InfoType                    PhraseType = "info"
+	ContentRequestType          PhraseType = "content_request"
+	RetryType                   PhraseType = "retry_request"
+	ContentNotFoundType         PhraseType = "content_not_found"
 )
 
 type MediaContentType string
@@ -26,3 +31,21 @@ const (
 	InfoCommand    CommandType = "info"
 	ContentCommand CommandType = "content"
 )
+
+type ContentSourceKind string
+
+const (
+	WallSource          ContentSourceKind = "wall"
+	PhotoAlbumSource    ContentSourceKind = "album"
+	VideoAlbumSource    ContentSourceKind = "video"
+	AudioPlaylistSource ContentSourceKind = "playlist"
+)
+
+type ContentMode string
+
+const (
+	RandomMode     ContentMode = "random"
+	LatestMode     ContentMode = "latest"
+	TopMode        ContentMode = "top"
+	SequentialMode ContentMode = "sequential"
+)
@@ -6,15 +6,35 @@ import (
 
 type PhraseRepository interface {
 	FindAll() []model.Phrase
-	FindAllByType(phraseType model.PhraseType) []model.Phrase
+	// FindAllByType finds phrases of a type in a locale, falling back to the default locale and then to any one
+	FindAllByType(phraseType model.PhraseType, locale string) []model.Phrase
 }
 
 type MembershipWarningRepository interface {
-	Insert(model.MembershipWarning) bool
+	Insert(...model.MembershipWarning) bool
 	UpdateAllToIrrelevant(...model.MembershipWarning) bool
+	UpdateRemindersSent(...model.MembershipWarning) bool
 	FindAllRelevant() []model.MembershipWarning
 }
 
+type KickedUserRepository interface {
+	Insert(...model.KickedUser) bool
+	FindByUserID(userID int) *model.KickedUser
+	Delete(userIDs ...int) bool
+}
+
+// MembershipExemptionRepository is read-only, exemptions are managed by moderators in the storage directly
+type MembershipExemptionRepository interface {
+	FindAllActive() []model.MembershipExemption
+	IsExempted(userID int) bool
+}
+
+// ContentCursorRepository keeps positions of sequential content commands, so they go on after a restart
+type ContentCursorRepository interface {
+	FindPosition(commandID int, source string) (int, error)
+	UpdatePosition(commandID int, source string, position int) bool
+}
+
 type CommandsRepository interface {
 	FindAll() []model.Command
 	FindByCommandAlias(command string) *model.Command
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// storageErrorKind a class of an object storage error which tells how the error has to be handled
+type storageErrorKind int
+
+const (
+	// unknownStorageError any other error, an operation is failed
+	unknownStorageError storageErrorKind = iota
+	// notFoundStorageError an object doesn't exist, so it's considered as empty
+	notFoundStorageError
+)
+
+// classifyStorageError classifies an object storage error by its type and http status instead of its message.
+// Transient errors are already retried by the sdk, so they're failed like unknown ones
+func classifyStorageError(err error) storageErrorKind {
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return notFoundStorageError
+	}
+
+	// other operations than GetObject don't have a typed error for missing objects
+	var responseErr *smithyhttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+		return notFoundStorageError
+	}
+
+	return unknownStorageError
+}
+
+func isNotFoundStorageError(err error) bool {
+	return classifyStorageError(err) == notFoundStorageError
+}
@@ -5,6 +5,7 @@ import (
 	"chattweiler/internal/repository/model"
 	"chattweiler/internal/utils"
 	"context"
+	"errors"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/jszwec/csvutil"
 	"io"
@@ -15,6 +16,9 @@ import (
 	"unsafe"
 )
 
+// a week, so top mode command gives the best posts of the week by default
+const defaultTopWindow = 7 * 24 * time.Hour
+
 type CsvObjectStorageCachedCommandRepository struct {
 	client               *s3.Client
 	bucket               string
@@ -194,11 +198,95 @@ func convertCsvContentCommand(csv *model.CsvCommand) model.Command {
 		types = append(types, model.MediaContentType(rawType))
 	}
 
+	var sources []model.ContentSource
+	if len(strings.TrimSpace(csv.CommunityIDs)) != 0 {
+		for _, rawSource := range strings.Split(csv.CommunityIDs, ",") {
+			source, err := model.ParseContentSource(rawSource)
+			if err != nil {
+				logging.Log.Error(logPackage, "convertCsvContentCommand", err, "content source of command %d is skipped", csv.ID)
+				continue
+			}
+			sources = append(sources, source)
+		}
+	}
+
+	var docExtensions []string
+	if len(strings.TrimSpace(csv.DocExtensions)) != 0 {
+		for _, extension := range strings.Split(csv.DocExtensions, ",") {
+			docExtensions = append(docExtensions, strings.TrimPrefix(strings.TrimSpace(extension), "."))
+		}
+	}
+
+	postFilter := model.PostFilter{
+		MinLikes:      csv.MinLikes,
+		MinReposts:    csv.MinReposts,
+		MinViews:      csv.MinViews,
+		ExcludePinned: csv.ExcludePinned,
+		ExcludeAds:    csv.ExcludeAds,
+	}
+
+	if len(strings.TrimSpace(csv.MaxPostAge)) != 0 {
+		maxPostAge, err := utils.ParseDuration(csv.MaxPostAge)
+		if err != nil {
+			logging.Log.Error(logPackage, "convertCsvContentCommand", err, "max post age of command %d is skipped", csv.ID)
+		}
+		postFilter.MaxPostAge = maxPostAge
+	}
+
+	if len(strings.TrimSpace(csv.TextBlocklist)) != 0 {
+		for _, word := range strings.Split(csv.TextBlocklist, ",") {
+			if word = strings.TrimSpace(word); len(word) != 0 {
+				postFilter.TextBlocklist = append(postFilter.TextBlocklist, strings.ToLower(word))
+			}
+		}
+	}
+
+	mode := csv.Mode
+	switch mode {
+	case model.RandomMode, model.LatestMode, model.TopMode, model.SequentialMode:
+	default:
+		if len(mode) != 0 {
+			logging.Log.Warn(logPackage, "convertCsvContentCommand", "unknown mode '%s' of command %d, random mode is used", mode, csv.ID)
+		}
+		mode = model.RandomMode
+	}
+
+	// ordered modes walk through community walls only
+	if mode != model.RandomMode {
+		var wallSources []model.ContentSource
+		for _, source := range sources {
+			if source.Kind != model.WallSource {
+				logging.Log.Error(logPackage, "convertCsvContentCommand", errors.New("album source in ordered mode"), "content source %s of command %d is skipped, mode '%s' supports only walls", source, csv.ID, mode)
+				continue
+			}
+			wallSources = append(wallSources, source)
+		}
+		sources = wallSources
+	}
+
+	topWindow := defaultTopWindow
+	if len(strings.TrimSpace(csv.TopWindow)) != 0 {
+		parsedTopWindow, err := utils.ParseDuration(csv.TopWindow)
+		if err != nil {
+			logging.Log.Error(logPackage, "convertCsvContentCommand", err, "top window of command %d is skipped", csv.ID)
+		} else {
+			topWindow = parsedTopWindow
+		}
+	}
+
 	return model.NewCommand(
 		csv.ID,
 		csv.Type,
 		strings.Split(csv.Commands, ","),
-		types,
-		strings.Split(csv.CommunityIDs, ","),
+		model.ContentDescriptor{
+			MediaContentType:   types,
+			ContentSources:     sources,
+			DocumentExtensions: docExtensions,
+			PostFilter:         postFilter,
+			SearchEnabled:      csv.SearchEnabled,
+			CaptionTemplate:    csv.CaptionTemplate,
+			Mode:               mode,
+			TopWindow:          topWindow,
+		},
 	)
 }
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"chattweiler/internal/repository/model"
+	"reflect"
+	"testing"
+
+	"github.com/jszwec/csvutil"
+)
+
+func TestConvertCsvContentCommandDocExtensions(t *testing.T) {
+	csvFile := "id,commands,command_type,media_types,community_ids,doc_extensions\n" +
+		"1,gif,content,doc,jazzjazz,\"gif, .PDF\"\n" +
+		"2,doc,content,doc,jazzjazz,\n"
+
+	var csvCommands []model.CsvCommand
+	err := csvutil.Unmarshal([]byte(csvFile), &csvCommands)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		csvCommand model.CsvCommand
+		expected   []string
+	}{
+		{csvCommands[0], []string{"gif", "PDF"}},
+		{csvCommands[1], nil},
+	}
+
+	for _, test := range tests {
+		actual := convertCsvContentCommand(&test.csvCommand).ContentDescriptor.DocumentExtensions
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Incorrect result for command %d. Actual: %v, Expected: %v", test.csvCommand.ID, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository/model"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jszwec/csvutil"
+	"io"
+	"sync"
+)
+
+// CsvObjectStorageContentCursorRepository keeps positions of sequential commands in one file,
+// the file is read once and rewritten on every update, since the bot is its only writer
+type CsvObjectStorageContentCursorRepository struct {
+	client *s3.Client
+	bucket string
+	key    string
+
+	mutex sync.Mutex
+	// nil until the file is read
+	cursors []model.ContentCursor
+}
+
+func NewCsvObjectStorageContentCursorRepository(client *s3.Client, bucket, key string) *CsvObjectStorageContentCursorRepository {
+	return &CsvObjectStorageContentCursorRepository{
+		client: client,
+		bucket: bucket,
+		key:    key,
+	}
+}
+
+// getCursors returns cursors which are read from the file once, must be called under the lock
+func (repo *CsvObjectStorageContentCursorRepository) getCursors() ([]model.ContentCursor, error) {
+	if repo.cursors != nil {
+		return repo.cursors, nil
+	}
+
+	object, err := repo.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: &repo.bucket,
+		Key:    &repo.key,
+	})
+	if err != nil {
+		// no sequential command is used yet
+		if isNotFoundStorageError(err) {
+			repo.cursors = []model.ContentCursor{}
+			return repo.cursors, nil
+		}
+
+		logging.Log.Error(
+			logPackage,
+			"CsvObjectStorageContentCursorRepository.getCursors",
+			err,
+			"s3 client error: bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return nil, err
+	}
+
+	csvFile, err := io.ReadAll(object.Body)
+	if err != nil {
+		logging.Log.Error(logPackage, "CsvObjectStorageContentCursorRepository.getCursors", err, "csv file reading error")
+		return nil, err
+	}
+
+	cursors := []model.ContentCursor{}
+	err = csvutil.Unmarshal(csvFile, &cursors)
+	if err != nil {
+		logging.Log.Error(logPackage, "CsvObjectStorageContentCursorRepository.getCursors", err, "csv file parsing error")
+		return nil, err
+	}
+
+	repo.cursors = cursors
+	return repo.cursors, nil
+}
+
+// FindPosition returns a position of a source of a command, 0 if it's not saved yet.
+// An error is returned if the file isn't read, so a position isn't reset by a storage failure
+func (repo *CsvObjectStorageContentCursorRepository) FindPosition(commandID int, source string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	cursors, err := repo.getCursors()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, cursor := range cursors {
+		if cursor.CommandID == commandID && cursor.Source == source {
+			return cursor.Position, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (repo *CsvObjectStorageContentCursorRepository) UpdatePosition(commandID int, source string, position int) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	cursors, err := repo.getCursors()
+	if err != nil {
+		return false
+	}
+
+	updatedCursors := make([]model.ContentCursor, 0, len(cursors)+1)
+	for _, cursor := range cursors {
+		if cursor.CommandID != commandID || cursor.Source != source {
+			updatedCursors = append(updatedCursors, cursor)
+		}
+	}
+	updatedCursors = append(updatedCursors, model.ContentCursor{CommandID: commandID, Source: source, Position: position})
+
+	updatedCsvFile, err := csvutil.Marshal(updatedCursors)
+	if err != nil {
+		logging.Log.Error(
+			logPackage,
+			"CsvObjectStorageContentCursorRepository.UpdatePosition",
+			err,
+			"cursors transformation to csv file error. bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return false
+	}
+
+	_, err = repo.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: &repo.bucket,
+		Key:    &repo.key,
+		Body:   bytes.NewReader(updatedCsvFile),
+	})
+	if err != nil {
+		logging.Log.Error(
+			logPackage,
+			"CsvObjectStorageContentCursorRepository.UpdatePosition",
+			err,
+			"csv file updating error. bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return false
+	}
+
+	repo.cursors = updatedCursors
+	return true
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository/model"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jszwec/csvutil"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+type CsvObjectStorageCachedMembershipExemptionRepository struct {
+	client               *s3.Client
+	bucket               string
+	key                  string
+	cacheRefreshInterval time.Duration
+	lastCacheRefresh     time.Time
+	refreshMutex         sync.Mutex
+
+	cachedMapByUserID map[int]model.MembershipExemption
+}
+
+func NewCsvObjectStorageCachedMembershipExemptionRepository(client *s3.Client, bucket, key string, cacheRefreshInterval time.Duration) *CsvObjectStorageCachedMembershipExemptionRepository {
+	repository := CsvObjectStorageCachedMembershipExemptionRepository{
+		client:               client,
+		bucket:               bucket,
+		key:                  key,
+		cacheRefreshInterval: cacheRefreshInterval,
+		lastCacheRefresh:     time.Now(),
+	}
+	err := repository.refreshCache()
+	if err != nil {
+		panic(err)
+	}
+	return &repository
+}
+
+func (repo *CsvObjectStorageCachedMembershipExemptionRepository) isNeededInvalidateCache() bool {
+	return time.Now().After(repo.lastCacheRefresh.Add(repo.cacheRefreshInterval))
+}
+
+func (repo *CsvObjectStorageCachedMembershipExemptionRepository) refreshCache() error {
+	startTime := time.Now().UnixMilli()
+
+	// cache refresh lock
+	repo.refreshMutex.Lock()
+	defer repo.refreshMutex.Unlock()
+
+	object, err := repo.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: &repo.bucket,
+		Key:    &repo.key,
+	})
+	if err != nil {
+		logging.Log.Error(
+			logPackage,
+			"CsvObjectStorageCachedMembershipExemptionRepository.refreshCache",
+			err,
+			"s3 client error: bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return err
+	}
+
+	csvFile, err := io.ReadAll(object.Body)
+	if err != nil {
+		logging.Log.Error(logPackage, "CsvObjectStorageCachedMembershipExemptionRepository.refreshCache", err, "csv file reading error")
+		return err
+	}
+
+	var exemptions []model.MembershipExemption
+	err = csvutil.Unmarshal(csvFile, &exemptions)
+	if err != nil {
+		logging.Log.Error(logPackage, "CsvObjectStorageCachedMembershipExemptionRepository.refreshCache", err, "csv file parsing error")
+		return err
+	}
+
+	var mapByUserID = make(map[int]model.MembershipExemption, len(exemptions))
+	for _, exemption := range exemptions {
+		mapByUserID[exemption.UserID] = exemption
+	}
+
+	mapByUserIDPtr := unsafe.Pointer(&mapByUserID)
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&repo.cachedMapByUserID)), mapByUserIDPtr)
+
+	repo.lastCacheRefresh = time.Now()
+	logging.Log.Info(logPackage, "CsvObjectStorageCachedMembershipExemptionRepository.refreshCache", "Cache successfully updated for %d ms", time.Now().UnixMilli()-startTime)
+	return nil
+}
+
+func (repo *CsvObjectStorageCachedMembershipExemptionRepository) getCachedMap() map[int]model.MembershipExemption {
+	if repo.isNeededInvalidateCache() {
+		// the previous cache is kept if the refresh is failed, so exempted users aren't warned by mistake
+		_ = repo.refreshCache()
+	}
+
+	ptr := atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&repo.cachedMapByUserID)))
+	if ptr != nil {
+		return *(*map[int]model.MembershipExemption)(ptr)
+	}
+	return nil
+}
+
+func (repo *CsvObjectStorageCachedMembershipExemptionRepository) FindAllActive() []model.MembershipExemption {
+	now := time.Now()
+	var activeExemptions []model.MembershipExemption
+	for _, exemption := range repo.getCachedMap() {
+		if exemption.IsActive(now) {
+			activeExemptions = append(activeExemptions, exemption)
+		}
+	}
+	return activeExemptions
+}
+
+func (repo *CsvObjectStorageCachedMembershipExemptionRepository) IsExempted(userID int) bool {
+	exemption, exists := repo.getCachedMap()[userID]
+	return exists && exemption.IsActive(time.Now())
+}
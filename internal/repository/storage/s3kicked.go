@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository/model"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jszwec/csvutil"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// CsvObjectStorageCachedKickedUserRepository keeps all kicked users in one file,
+// since a record lives until a user subscribes, regardless of days.
+// Lookups are served from the cache, changes are written to the file and to the cache at once
+type CsvObjectStorageCachedKickedUserRepository struct {
+	client               *s3.Client
+	bucket               string
+	key                  string
+	cacheRefreshInterval time.Duration
+	lastCacheRefresh     time.Time
+	refreshMutex         sync.Mutex
+
+	// changes lock, a file is read and rewritten under it
+	mutex sync.Mutex
+
+	cachedMapByUserID map[int]model.KickedUser
+}
+
+func NewCsvObjectStorageCachedKickedUserRepository(client *s3.Client, bucket, key string, cacheRefreshInterval time.Duration) *CsvObjectStorageCachedKickedUserRepository {
+	repository := CsvObjectStorageCachedKickedUserRepository{
+		client:               client,
+		bucket:               bucket,
+		key:                  key,
+		cacheRefreshInterval: cacheRefreshInterval,
+		lastCacheRefresh:     time.Now(),
+	}
+	err := repository.refreshCache()
+	if err != nil {
+		panic(err)
+	}
+	return &repository
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) isNeededInvalidateCache() bool {
+	return time.Now().After(repo.lastCacheRefresh.Add(repo.cacheRefreshInterval))
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) refreshCache() error {
+	startTime := time.Now().UnixMilli()
+
+	// cache refresh lock
+	repo.refreshMutex.Lock()
+	defer repo.refreshMutex.Unlock()
+
+	kickedUsers, err := repo.getKickedUsers()
+	if err != nil {
+		return err
+	}
+
+	repo.storeCache(kickedUsers)
+	logging.Log.Info(logPackage, "CsvObjectStorageCachedKickedUserRepository.refreshCache", "Cache successfully updated for %d ms", time.Now().UnixMilli()-startTime)
+	return nil
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) storeCache(kickedUsers []model.KickedUser) {
+	var mapByUserID = make(map[int]model.KickedUser, len(kickedUsers))
+	for _, kickedUser := range kickedUsers {
+		mapByUserID[kickedUser.UserID] = kickedUser
+	}
+
+	mapByUserIDPtr := unsafe.Pointer(&mapByUserID)
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&repo.cachedMapByUserID)), mapByUserIDPtr)
+	repo.lastCacheRefresh = time.Now()
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) getCachedMap() map[int]model.KickedUser {
+	if repo.isNeededInvalidateCache() {
+		// the previous cache is kept if the refresh is failed
+		_ = repo.refreshCache()
+	}
+
+	ptr := atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&repo.cachedMapByUserID)))
+	if ptr != nil {
+		return *(*map[int]model.KickedUser)(ptr)
+	}
+	return nil
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) getKickedUsers() ([]model.KickedUser, error) {
+	object, err := repo.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: &repo.bucket,
+		Key:    &repo.key,
+	})
+	if err != nil {
+		// nobody is kicked yet
+		if isNotFoundStorageError(err) {
+			return []model.KickedUser{}, nil
+		}
+
+		logging.Log.Error(
+			logPackage,
+			"CsvObjectStorageCachedKickedUserRepository.getKickedUsers",
+			err,
+			"s3 client error: bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return nil, err
+	}
+
+	csvFile, err := io.ReadAll(object.Body)
+	if err != nil {
+		logging.Log.Error(logPackage, "CsvObjectStorageCachedKickedUserRepository.getKickedUsers", err, "csv file reading error")
+		return nil, err
+	}
+
+	var kickedUsers []model.KickedUser
+	err = csvutil.Unmarshal(csvFile, &kickedUsers)
+	if err != nil {
+		logging.Log.Error(logPackage, "CsvObjectStorageCachedKickedUserRepository.getKickedUsers", err, "csv file parsing error")
+		return nil, err
+	}
+
+	return kickedUsers, nil
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) putKickedUsers(funcName string, kickedUsers []model.KickedUser) bool {
+	updatedCsvFile, err := csvutil.Marshal(kickedUsers)
+	if err != nil {
+		logging.Log.Error(
+			logPackage,
+			funcName,
+			err,
+			"kicked users transformation to csv file error. bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return false
+	}
+
+	_, err = repo.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: &repo.bucket,
+		Key:    &repo.key,
+		Body:   bytes.NewReader(updatedCsvFile),
+	})
+	if err != nil {
+		logging.Log.Error(
+			logPackage,
+			funcName,
+			err,
+			"csv file updating error. bucket - %s, key - %s", repo.bucket, repo.key,
+		)
+		return false
+	}
+
+	repo.storeCache(kickedUsers)
+	return true
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) Insert(kickedUsers ...model.KickedUser) bool {
+	startTime := time.Now().UnixMilli()
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	storedKickedUsers, err := repo.getKickedUsers()
+	if err != nil {
+		return false
+	}
+
+	// a user is kept once with the latest kick
+	newKickedUsers := make(map[int]bool, len(kickedUsers))
+	for _, kickedUser := range kickedUsers {
+		newKickedUsers[kickedUser.UserID] = true
+	}
+
+	var updatedKickedUsers []model.KickedUser
+	for _, kickedUser := range storedKickedUsers {
+		if !newKickedUsers[kickedUser.UserID] {
+			updatedKickedUsers = append(updatedKickedUsers, kickedUser)
+		}
+	}
+	updatedKickedUsers = append(updatedKickedUsers, kickedUsers...)
+
+	if !repo.putKickedUsers("CsvObjectStorageCachedKickedUserRepository.Insert", updatedKickedUsers) {
+		return false
+	}
+
+	logging.Log.Info(logPackage, "CsvObjectStorageCachedKickedUserRepository.Insert", "inserted for %d ms", time.Now().UnixMilli()-startTime)
+	return true
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) FindByUserID(userID int) *model.KickedUser {
+	kickedUser, exists := repo.getCachedMap()[userID]
+	if !exists {
+		return nil
+	}
+	return &kickedUser
+}
+
+func (repo *CsvObjectStorageCachedKickedUserRepository) Delete(userIDs ...int) bool {
+	startTime := time.Now().UnixMilli()
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	kickedUsers, err := repo.getKickedUsers()
+	if err != nil {
+		return false
+	}
+
+	deletedUserIDs := make(map[int]bool, len(userIDs))
+	for _, userID := range userIDs {
+		deletedUserIDs[userID] = true
+	}
+
+	var updatedKickedUsers []model.KickedUser
+	for _, kickedUser := range kickedUsers {
+		if !deletedUserIDs[kickedUser.UserID] {
+			updatedKickedUsers = append(updatedKickedUsers, kickedUser)
+		}
+	}
+
+	if !repo.putKickedUsers("CsvObjectStorageCachedKickedUserRepository.Delete", updatedKickedUsers) {
+		return false
+	}
+
+	logging.Log.Info(logPackage, "CsvObjectStorageCachedKickedUserRepository.Delete", "deleted for %d ms", time.Now().UnixMilli()-startTime)
+	return true
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/jszwec/csvutil"
 	"io"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,6 +17,10 @@ type CsvObjectStorageMembershipWarningRepository struct {
 	client      *s3.Client
 	bucket      string
 	currentDate time.Time
+
+	// a day file and the current date are read and rewritten under it,
+	// since the check cycle and checks of rejoined users write warnings at the same time
+	mutex sync.Mutex
 }
 
 func NewCsvObjectStorageMembershipWarningRepository(client *s3.Client, bucket string) *CsvObjectStorageMembershipWarningRepository {
@@ -55,6 +59,14 @@ func (repo *CsvObjectStorageMembershipWarningRepository) filterOnlyRelevant(warn
 }
 
 func (repo *CsvObjectStorageMembershipWarningRepository) FindAllRelevant() []model.MembershipWarning {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	return repo.findAllRelevant()
+}
+
+// findAllRelevant moves relevant warnings to a file of a new day if the date is changed, must be called under the lock
+func (repo *CsvObjectStorageMembershipWarningRepository) findAllRelevant() []model.MembershipWarning {
 	now := time.Now()
 	startTime := now.UnixMilli()
 	if !isTheSameDate(repo.currentDate, now) {
@@ -71,7 +83,7 @@ func (repo *CsvObjectStorageMembershipWarningRepository) FindAllRelevant() []mod
 				err,
 				"s3 client error: bucket - %s, key - %s", repo.bucket, previousKey,
 			)
-			if strings.Contains(err.Error(), "StatusCode: 404") {
+			if isNotFoundStorageError(err) {
 				repo.currentDate = now
 				logging.Log.Warn(
 					logPackage,
@@ -138,7 +150,7 @@ func (repo *CsvObjectStorageMembershipWarningRepository) FindAllRelevant() []mod
 		Key:    &currentKey,
 	})
 	if err != nil {
-		if !strings.Contains(err.Error(), "StatusCode: 404") {
+		if !isNotFoundStorageError(err) {
 			logging.Log.Error(
 				logPackage,
 				"CsvObjectStorageMembershipWarningRepository.FindAllRelevant",
@@ -165,12 +177,15 @@ func (repo *CsvObjectStorageMembershipWarningRepository) FindAllRelevant() []mod
 	return relevantWarnings
 }
 
-func (repo *CsvObjectStorageMembershipWarningRepository) Insert(warning model.MembershipWarning) bool {
+func (repo *CsvObjectStorageMembershipWarningRepository) Insert(warnings ...model.MembershipWarning) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
 	now := time.Now()
 	startTime := now.UnixMilli()
 	var warningsToInsert []model.MembershipWarning
 	if !isTheSameDate(repo.currentDate, now) {
-		warningsToInsert = repo.FindAllRelevant()
+		warningsToInsert = repo.findAllRelevant()
 	} else {
 		currentKey := getDateAsString(repo.currentDate)
 		object, err := repo.client.GetObject(context.TODO(), &s3.GetObjectInput{
@@ -178,7 +193,18 @@ func (repo *CsvObjectStorageMembershipWarningRepository) Insert(warning model.Me
 			Key:    &currentKey,
 		})
 
-		if err != nil && !strings.Contains(err.Error(), "NoSuchKey") {
+		if err != nil && !isNotFoundStorageError(err) {
+			logging.Log.Error(
+				logPackage,
+				"CsvObjectStorageMembershipWarningRepository.Insert",
+				err,
+				"s3 client error: bucket - %s, key - %s", repo.bucket, currentKey,
+			)
+			return false
+		}
+
+		// warnings of the day are kept, a file for a new day is created from scratch
+		if err == nil {
 			warningsToInsert, err = repo.getWarnings(object.Body)
 			if err != nil {
 				logging.Log.Error(
@@ -192,7 +218,7 @@ func (repo *CsvObjectStorageMembershipWarningRepository) Insert(warning model.Me
 		}
 	}
 
-	warningsToInsert = append(warningsToInsert, warning)
+	warningsToInsert = append(warningsToInsert, warnings...)
 	currentKey := getDateAsString(repo.currentDate)
 	updatedCsvFile, err := csvutil.Marshal(warningsToInsert)
 	if err != nil {
@@ -226,17 +252,37 @@ func (repo *CsvObjectStorageMembershipWarningRepository) Insert(warning model.Me
 }
 
 func (repo *CsvObjectStorageMembershipWarningRepository) UpdateAllToIrrelevant(warnings ...model.MembershipWarning) bool {
+	return repo.updateAll("CsvObjectStorageMembershipWarningRepository.UpdateAllToIrrelevant", warnings, func(stored *model.MembershipWarning, _ model.MembershipWarning) {
+		stored.IsRelevant = false
+	})
+}
+
+func (repo *CsvObjectStorageMembershipWarningRepository) UpdateRemindersSent(warnings ...model.MembershipWarning) bool {
+	return repo.updateAll("CsvObjectStorageMembershipWarningRepository.UpdateRemindersSent", warnings, func(stored *model.MembershipWarning, warning model.MembershipWarning) {
+		stored.RemindersSent = warning.RemindersSent
+	})
+}
+
+// updateAll applies an update to stored warnings of the same users as the given ones
+func (repo *CsvObjectStorageMembershipWarningRepository) updateAll(
+	funcName string,
+	warnings []model.MembershipWarning,
+	update func(stored *model.MembershipWarning, warning model.MembershipWarning),
+) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
 	now := time.Now()
 	startTime := now.UnixMilli()
 
-	irrelevantWarnings := make(map[int]model.MembershipWarning)
+	warningsToUpdate := make(map[int]model.MembershipWarning)
 	for _, warning := range warnings {
-		irrelevantWarnings[warning.UserID] = warning
+		warningsToUpdate[warning.UserID] = warning
 	}
 
 	var warningsToUpdateArray []model.MembershipWarning
 	if !isTheSameDate(repo.currentDate, now) {
-		warningsToUpdateArray = repo.FindAllRelevant()
+		warningsToUpdateArray = repo.findAllRelevant()
 	} else {
 		currentKey := getDateAsString(repo.currentDate)
 		object, err := repo.client.GetObject(context.TODO(), &s3.GetObjectInput{
@@ -246,7 +292,7 @@ func (repo *CsvObjectStorageMembershipWarningRepository) UpdateAllToIrrelevant(w
 		if err != nil {
 			logging.Log.Error(
 				logPackage,
-				"CsvObjectStorageMembershipWarningRepository.UpdateAllToIrrelevant",
+				funcName,
 				err,
 				"s3 client error. bucket - %s, key - %s", repo.bucket, currentKey,
 			)
@@ -257,7 +303,7 @@ func (repo *CsvObjectStorageMembershipWarningRepository) UpdateAllToIrrelevant(w
 		if err != nil {
 			logging.Log.Error(
 				logPackage,
-				"CsvObjectStorageMembershipWarningRepository.UpdateAllToIrrelevant",
+				funcName,
 				err,
 				"s3 client error. bucket - %s, key - %s", repo.bucket, currentKey,
 			)
@@ -266,8 +312,8 @@ func (repo *CsvObjectStorageMembershipWarningRepository) UpdateAllToIrrelevant(w
 	}
 
 	for index, warning := range warningsToUpdateArray {
-		if _, ok := irrelevantWarnings[warning.UserID]; ok {
-			warningsToUpdateArray[index].IsRelevant = false
+		if warningToUpdate, ok := warningsToUpdate[warning.UserID]; ok && warning.IsRelevant {
+			update(&warningsToUpdateArray[index], warningToUpdate)
 		}
 	}
 
@@ -276,7 +322,7 @@ func (repo *CsvObjectStorageMembershipWarningRepository) UpdateAllToIrrelevant(w
 	if err != nil {
 		logging.Log.Error(
 			logPackage,
-			"CsvObjectStorageMembershipWarningRepository.UpdateAllToIrrelevant",
+			funcName,
 			err,
 			"relevant warnings transformation to csv file error. bucket - %s, key - %s", repo.bucket, currentKey,
 		)
@@ -292,14 +338,14 @@ func (repo *CsvObjectStorageMembershipWarningRepository) UpdateAllToIrrelevant(w
 	if err != nil {
 		logging.Log.Error(
 			logPackage,
-			"CsvObjectStorageMembershipWarningRepository.UpdateAllToIrrelevant",
+			funcName,
 			err,
 			"csv file updating error",
 		)
 		return false
 	}
 
-	logging.Log.Info(logPackage, "CsvObjectStorageMembershipWarningRepository.UpdateAllToIrrelevant", "updated for %d ms", time.Now().UnixMilli()-startTime)
+	logging.Log.Info(logPackage, funcName, "updated for %d ms", time.Now().UnixMilli()-startTime)
 	return true
 }
 
@@ -3,6 +3,7 @@ package storage
 import (
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository/model"
+	"chattweiler/internal/templating"
 	"context"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/jszwec/csvutil"
@@ -18,6 +19,8 @@ type CsvObjectStorageCachedPhraseRepository struct {
 	bucket               string
 	key                  string
 	cacheRefreshInterval time.Duration
+	defaultLocale        string
+	location             *time.Location
 	lastCacheRefresh     time.Time
 	refreshMutex         sync.Mutex
 
@@ -25,12 +28,14 @@ type CsvObjectStorageCachedPhraseRepository struct {
 	cachedListsByType map[model.PhraseType][]model.Phrase
 }
 
-func NewCsvObjectStorageCachedPhraseRepository(client *s3.Client, bucket, key string, cacheRefreshInterval time.Duration) *CsvObjectStorageCachedPhraseRepository {
+func NewCsvObjectStorageCachedPhraseRepository(client *s3.Client, bucket, key string, cacheRefreshInterval time.Duration, defaultLocale string, location *time.Location) *CsvObjectStorageCachedPhraseRepository {
 	repository := CsvObjectStorageCachedPhraseRepository{
 		client:               client,
 		bucket:               bucket,
 		key:                  key,
 		cacheRefreshInterval: cacheRefreshInterval,
+		defaultLocale:        defaultLocale,
+		location:             location,
 		lastCacheRefresh:     time.Now(),
 	}
 	err := repository.refreshCache()
@@ -78,7 +83,7 @@ func (repo *CsvObjectStorageCachedPhraseRepository) refreshCache() error {
 		return err
 	}
 
-	var list = convertCsvPhrases(csvPhrases)
+	var list = convertCsvPhrases(filterValidPhrases(csvPhrases))
 
 	var mapByType = make(map[model.PhraseType][]model.Phrase)
 	for _, phrase := range list {
@@ -114,7 +119,7 @@ func (repo *CsvObjectStorageCachedPhraseRepository) FindAll() []model.Phrase {
 	return nil
 }
 
-func (repo *CsvObjectStorageCachedPhraseRepository) FindAllByType(phraseType model.PhraseType) []model.Phrase {
+func (repo *CsvObjectStorageCachedPhraseRepository) FindAllByType(phraseType model.PhraseType, locale string) []model.Phrase {
 	if repo.isNeededInvalidateCache() {
 		err := repo.refreshCache()
 		if err != nil {
@@ -126,7 +131,7 @@ func (repo *CsvObjectStorageCachedPhraseRepository) FindAllByType(phraseType mod
 	if ptr != nil {
 		phrases := *(*map[model.PhraseType][]model.Phrase)(ptr)
 		if phrasesByType, exists := phrases[phraseType]; exists {
-			return phrasesByType
+			return model.SelectPhrasesByLocale(filterActivePhrases(phrasesByType, time.Now().In(repo.location)), locale, repo.defaultLocale)
 		}
 	}
 	return []model.Phrase{}
@@ -147,6 +152,43 @@ func isTheSameDate(first, second time.Time) bool {
 	return true
 }
 
+// filterValidPhrases excludes phrases which templates or schedules are broken, so they're never sent
+func filterValidPhrases(phrases []model.Phrase) []model.Phrase {
+	var validPhrases []model.Phrase
+	for _, phrase := range phrases {
+		err := templating.Validate(phrase.Text)
+		if err != nil {
+			logging.Log.Error(logPackage, "filterValidPhrases", err, "phrase %d is excluded, its template is invalid", phrase.PhraseID)
+			continue
+		}
+
+		err = phrase.ValidateSchedule()
+		if err != nil {
+			logging.Log.Error(logPackage, "filterValidPhrases", err, "phrase %d is excluded, its schedule is invalid", phrase.PhraseID)
+			continue
+		}
+		validPhrases = append(validPhrases, phrase)
+	}
+	return validPhrases
+}
+
+// filterActivePhrases excludes phrases which are out of their active hours, weekdays or dates
+func filterActivePhrases(phrases []model.Phrase, now time.Time) []model.Phrase {
+	var activePhrases []model.Phrase
+	for _, phrase := range phrases {
+		isActive, err := phrase.IsActive(now)
+		if err != nil {
+			logging.Log.Error(logPackage, "filterActivePhrases", err, "phrase %d is skipped, its schedule is invalid", phrase.PhraseID)
+			continue
+		}
+
+		if isActive {
+			activePhrases = append(activePhrases, phrase)
+		}
+	}
+	return activePhrases
+}
+
 func convertCsvPhrases(phrases []model.Phrase) []model.Phrase {
 	result := make([]model.Phrase, len(phrases))
 	for index, value := range phrases {
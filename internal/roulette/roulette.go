@@ -6,6 +6,7 @@ package roulette
 import (
 	"chattweiler/internal/repository/model"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -50,3 +51,125 @@ func Spin(phrases ...model.Phrase) *model.Phrase {
 
 	return nil
 }
+
+// SpinContentSource picks up a source of content commands by its weight
+func SpinContentSource(sources ...model.ContentSource) *model.ContentSource {
+	return SpinBy(sources, func(source model.ContentSource) int {
+		return source.Weight
+	})
+}
+
+// SpinBy picks up an item by its weight, unlike Spin items without weight are picked up only if all of them have no weight
+func SpinBy[T any](items []T, weight func(item T) int) *T {
+	if len(items) == 0 {
+		return nil
+	}
+
+	totalWeight := 0
+	for _, item := range items {
+		totalWeight += weight(item)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	if totalWeight == 0 {
+		item := items[rand.Intn(len(items))]
+		return &item
+	}
+
+	bingo := rand.Intn(totalWeight)
+	for _, item := range items {
+		bingo -= weight(item)
+		if bingo < 0 {
+			return &item
+		}
+	}
+
+	item := items[len(items)-1]
+	return &item
+}
+
+// Selector a strategy of phrases picking for a chat
+type Selector interface {
+	Select(peerId int, phrases ...model.Phrase) *model.Phrase
+}
+
+// SpinSelector picks up phrases only by their weights, see Spin
+type SpinSelector struct{}
+
+func (SpinSelector) Select(_ int, phrases ...model.Phrase) *model.Phrase {
+	return Spin(phrases...)
+}
+
+type historyKey struct {
+	peerId     int
+	phraseType model.PhraseType
+}
+
+// AntiRepeatSelector multiplies weights of phrases which were picked up in the last selections
+// by a factor, so small pools of phrases don't repeat the same phrase back-to-back.
+// Selections are remembered for every chat and phrase type separately
+type AntiRepeatSelector struct {
+	historySize  int
+	weightFactor float64
+
+	mutex   sync.Mutex
+	history map[historyKey][]int
+}
+
+func NewAntiRepeatSelector(historySize int, weightFactor float64) *AntiRepeatSelector {
+	return &AntiRepeatSelector{
+		historySize:  historySize,
+		weightFactor: weightFactor,
+		history:      make(map[historyKey][]int),
+	}
+}
+
+func (selector *AntiRepeatSelector) Select(peerId int, phrases ...model.Phrase) *model.Phrase {
+	if len(phrases) == 0 {
+		return nil
+	}
+
+	selector.mutex.Lock()
+	defer selector.mutex.Unlock()
+
+	key := historyKey{peerId: peerId, phraseType: phrases[0].PhraseType}
+	recentlyUsed := make(map[int]bool, len(selector.history[key]))
+	for _, phraseId := range selector.history[key] {
+		recentlyUsed[phraseId] = true
+	}
+
+	var weighted []model.Phrase
+	for _, phrase := range phrases {
+		if recentlyUsed[phrase.PhraseID] {
+			phrase.Weight = int(float64(phrase.Weight) * selector.weightFactor)
+			// Spin could pick up a phrase without weight, so such phrases are excluded
+			if phrase.Weight <= 0 {
+				continue
+			}
+		}
+		weighted = append(weighted, phrase)
+	}
+
+	// all the phrases were used recently, so there's nothing to prefer
+	if len(weighted) == 0 {
+		weighted = phrases
+	}
+
+	selected := Spin(weighted...)
+	if selected == nil {
+		return nil
+	}
+
+	selector.history[key] = append(selector.history[key], selected.PhraseID)
+	if len(selector.history[key]) > selector.historySize {
+		selector.history[key] = selector.history[key][len(selector.history[key])-selector.historySize:]
+	}
+
+	// a phrase is returned with its original weight
+	for _, phrase := range phrases {
+		if phrase.PhraseID == selected.PhraseID {
+			return &phrase
+		}
+	}
+	return selected
+}
@@ -25,3 +25,43 @@ func TestSpinWithOnePhrase(t *testing.T) {
 		t.Errorf("Spin result with a single phrase not the same")
 	}
 }
+
+func TestSpinContentSourceSkipsSourcesWithoutWeight(t *testing.T) {
+	sources := []model.ContentSource{{Domain: "first", Weight: 0}, {Domain: "second", Weight: 1}, {Domain: "third", Weight: 0}}
+
+	for i := 0; i < 10; i++ {
+		if bingo := SpinContentSource(sources...); bingo == nil || bingo.Domain != "second" {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", bingo, sources[1])
+		}
+	}
+}
+
+func TestAntiRepeatSelectorDoesNotRepeatRecentPhrases(t *testing.T) {
+	phrases := []model.Phrase{
+		{PhraseID: 1, Weight: 100, PhraseType: model.WelcomeType},
+		{PhraseID: 2, Weight: 100, PhraseType: model.WelcomeType},
+		{PhraseID: 3, Weight: 100, PhraseType: model.WelcomeType},
+	}
+	selector := NewAntiRepeatSelector(2, 0)
+
+	var selected []int
+	for i := 0; i < 9; i++ {
+		selected = append(selected, selector.Select(1, phrases...).PhraseID)
+	}
+
+	for index := 2; index < len(selected); index++ {
+		if selected[index] == selected[index-1] || selected[index] == selected[index-2] {
+			t.Errorf("Incorrect result. Actual: %v, Expected: no repeats among 3 consecutive phrases", selected)
+		}
+	}
+
+	// another chat has its own history
+	if bingo := selector.Select(2, phrases[0]); bingo == nil || bingo.PhraseID != 1 || bingo.Weight != 100 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", bingo, phrases[0])
+	}
+
+	// the only phrase is picked up even if it's used recently
+	if bingo := selector.Select(2, phrases[0]); bingo == nil || bingo.PhraseID != 1 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", bingo, phrases[0])
+	}
+}
@@ -0,0 +1,214 @@
+package templating
+
+import (
+	"chattweiler/internal/localization"
+	"chattweiler/internal/logging"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+var logPackage = "templating"
+
+// https://dev.vk.com/reference/objects/user#sex
+const (
+	femaleSex = 1
+	maleSex   = 2
+)
+
+// User a user who is mentioned by a phrase
+type User struct {
+	ID         int
+	FirstName  string
+	LastName   string
+	ScreenName string
+	// 1 - female, 2 - male, 0 - not specified
+	Sex   int
+	Photo string
+}
+
+func NewUser(user object.UsersUser) User {
+	return User{
+		ID:         user.ID,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		ScreenName: user.ScreenName,
+		Sex:        user.Sex,
+		Photo:      user.Photo100,
+	}
+}
+
+// Mention a mention link of a user with his first name (e.g. "@john_2001 (John)")
+func (user User) Mention() string {
+	if len(user.FirstName) == 0 {
+		return "@" + user.ScreenName
+	}
+	return fmt.Sprintf("@%s (%s)", user.ScreenName, user.FirstName)
+}
+
+func (user User) FullName() string {
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// Chat a chat which a phrase is sent to
+type Chat struct {
+	Name        string
+	MemberCount int
+}
+
+// Data values which a phrase template could use (e.g. "{{.User.FirstName}}, welcome to {{.ChatName}}!")
+type Data struct {
+	// mentioned users, the first one is available as .User
+	Users []User
+	// arguments of a command (e.g. a query of a content command)
+	Args string
+	// mentions of communities which membership is required, only for membership phrases
+	MissingCommunities string
+	Now                time.Time
+	// locales of built-in texts (e.g. the time of day) in order of preference
+	Locales []string
+
+	// a chat is fetched only if a template uses it
+	chatLoader func() (Chat, error)
+	chatOnce   sync.Once
+	chat       Chat
+}
+
+func NewData(now time.Time, chatLoader func() (Chat, error)) *Data {
+	return &Data{
+		Now:        now,
+		chatLoader: chatLoader,
+	}
+}
+
+func (data *Data) User() User {
+	if len(data.Users) == 0 {
+		return User{}
+	}
+	return data.Users[0]
+}
+
+// Mentions mention links of all the users separated by comma and the localized conjunction before the last one
+func (data *Data) Mentions() string {
+	mentions := make([]string, len(data.Users))
+	for index, user := range data.Users {
+		mentions[index] = user.Mention()
+	}
+	return localization.JoinList(mentions, data.Locales...)
+}
+
+func (data *Data) ChatName() string {
+	return data.getChat().Name
+}
+
+func (data *Data) MemberCount() int {
+	return data.getChat().MemberCount
+}
+
+// TimeOfDay either morning (5-12), afternoon (12-17), evening (17-23) or night in the data's locale
+func (data *Data) TimeOfDay() string {
+	hour := data.Now.Hour()
+	switch {
+	case hour >= 5 && hour < 12:
+		return localization.Text(localization.MorningText, data.Locales...)
+	case hour >= 12 && hour < 17:
+		return localization.Text(localization.AfternoonText, data.Locales...)
+	case hour >= 17 && hour < 23:
+		return localization.Text(localization.EveningText, data.Locales...)
+	default:
+		return localization.Text(localization.NightText, data.Locales...)
+	}
+}
+
+func (data *Data) getChat() Chat {
+	data.chatOnce.Do(func() {
+		if data.chatLoader == nil {
+			return
+		}
+
+		chat, err := data.chatLoader()
+		if err != nil {
+			logging.Log.Error(logPackage, "Data.getChat", err, "chat fetching error, chat placeholders are empty")
+			return
+		}
+		data.chat = chat
+	})
+	return data.chat
+}
+
+var functions = template.FuncMap{
+	"gender": gender,
+	"plural": plural,
+}
+
+// gender picks a word form by sex of a user (e.g. {{gender .User "пришёл" "пришла"}}),
+// the optional third form is used if sex isn't specified, the masculine one otherwise
+func gender(user User, masculine, feminine string, unspecified ...string) string {
+	switch {
+	case user.Sex == femaleSex:
+		return feminine
+	case user.Sex == maleSex || len(unspecified) == 0:
+		return masculine
+	default:
+		return unspecified[0]
+	}
+}
+
+// plural picks a word form by a number using russian rules (e.g. {{plural .MemberCount "участник" "участника" "участников"}})
+func plural(number int, one, few, many string) string {
+	if number < 0 {
+		number = -number
+	}
+
+	switch {
+	case number%100 >= 11 && number%100 <= 14:
+		return many
+	case number%10 == 1:
+		return one
+	case number%10 >= 2 && number%10 <= 4:
+		return few
+	default:
+		return many
+	}
+}
+
+// IsTemplate tells whether a phrase is a template, otherwise it could use only %username% like placeholders
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func Render(text string, data *Data) (string, error) {
+	parsed, err := template.New("phrase").Funcs(functions).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	err = parsed.Execute(&builder, data)
+	if err != nil {
+		return "", err
+	}
+
+	return builder.String(), nil
+}
+
+// Validate renders a template with sample data, so unknown fields and functions are found before a phrase is used
+func Validate(text string) error {
+	if !IsTemplate(text) {
+		return nil
+	}
+
+	sample := NewData(time.Now(), func() (Chat, error) {
+		return Chat{Name: "chat", MemberCount: 1}, nil
+	})
+	sample.Users = []User{{ID: 1, FirstName: "John", LastName: "Doe", ScreenName: "john_doe", Sex: maleSex}}
+	sample.Args = "args"
+	sample.MissingCommunities = "@community"
+
+	_, err := Render(text, sample)
+	return err
+}
@@ -0,0 +1,55 @@
+package templating
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	data := NewData(time.Date(2022, 10, 31, 9, 0, 0, 0, time.UTC), func() (Chat, error) {
+		return Chat{Name: "Jazz", MemberCount: 22}, nil
+	})
+	data.Users = []User{{FirstName: "Anna", ScreenName: "anna", Sex: femaleSex}}
+	data.Locales = []string{"ru"}
+
+	actual, err := Render(`{{.User.Mention}} {{gender .User "пришёл" "пришла"}} в {{.ChatName}}, нас {{.MemberCount}} {{plural .MemberCount "участник" "участника" "участников"}}, {{.TimeOfDay}}`, data)
+	expected := "@anna (Anna) пришла в Jazz, нас 22 участника, утро"
+	if err != nil || actual != expected {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	for number, expected := range map[int]string{1: "one", 3: "few", 5: "many", 11: "many", 12: "many", 21: "one", 104: "few"} {
+		actual := plural(number, "one", "few", "many")
+		if actual != expected {
+			t.Errorf("Incorrect result for %d. Actual: %v, Expected: %v", number, actual, expected)
+		}
+	}
+}
+
+func TestGender(t *testing.T) {
+	if actual := gender(User{}, "m", "f"); actual != "m" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, "m")
+	}
+
+	if actual := gender(User{}, "m", "f", "n"); actual != "n" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, "n")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate("%username%, welcome!"); err != nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", err, nil)
+	}
+
+	if err := Validate("{{.User.FirstName}}, welcome!"); err != nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", err, nil)
+	}
+
+	for _, text := range []string{"{{.User.Nickname}}", "{{.User.FirstName", "{{unknown .User}}"} {
+		if err := Validate(text); err == nil {
+			t.Errorf("Incorrect result for %s. Actual: %v, Expected: an error", text, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDurationInDays(t *testing.T) {
+	expected := 30 * 24 * time.Hour
+	actual, err := ParseDuration("30d")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if expected != actual {
+		t.Errorf("Incorrect result. Actual: %s, Expected: %s", actual, expected)
+	}
+}
+
+func TestParseDurationInHours(t *testing.T) {
+	expected := 12 * time.Hour
+	actual, err := ParseDuration("12h")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if expected != actual {
+		t.Errorf("Incorrect result. Actual: %s, Expected: %s", actual, expected)
+	}
+}
@@ -0,0 +1,186 @@
+package vk
+
+import (
+	"chattweiler/internal/configs"
+	"chattweiler/internal/logging"
+	"chattweiler/internal/utils"
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type apiHandler func(method string, params ...api.Params) (api.Response, error)
+
+// RequestPolicy describes how api calls are limited and retried
+type RequestPolicy struct {
+	// a max number of calls per second for each token
+	RequestsPerSecond int
+	// a max number of repeated calls after transient errors (6, 9, 10)
+	MaxRetries int
+	// a backoff before the first retry, it's doubled for every next one
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// a deadline for a call with all its retries, if a caller didn't pass his own context
+	RequestTimeout time.Duration
+}
+
+// NewRequestPolicy creates a policy from configurations for tokens with the given requests rate
+func NewRequestPolicy(requestsPerSecondConfig configs.ApplicationConfig) (RequestPolicy, error) {
+	requestsPerSecond, err := strconv.Atoi(utils.GetEnvOrDefault(requestsPerSecondConfig))
+	if err != nil {
+		return RequestPolicy{}, err
+	}
+
+	maxRetries, err := strconv.Atoi(utils.GetEnvOrDefault(configs.VkRequestMaxRetries))
+	if err != nil {
+		return RequestPolicy{}, err
+	}
+
+	baseBackoff, err := time.ParseDuration(utils.GetEnvOrDefault(configs.VkRequestRetryBaseBackoff))
+	if err != nil {
+		return RequestPolicy{}, err
+	}
+
+	requestTimeout, err := time.ParseDuration(utils.GetEnvOrDefault(configs.VkRequestTimeout))
+	if err != nil {
+		return RequestPolicy{}, err
+	}
+
+	return RequestPolicy{
+		RequestsPerSecond: requestsPerSecond,
+		MaxRetries:        maxRetries,
+		BaseBackoff:       baseBackoff,
+		MaxBackoff:        10 * baseBackoff,
+		RequestTimeout:    requestTimeout,
+	}, nil
+}
+
+// WithRequestPolicy makes all calls of an api client go through per-token rate limiting
+// and retries of transient errors with jittered exponential backoff
+func WithRequestPolicy(vkapi *api.VK, policy RequestPolicy) *api.VK {
+	// the sdk limits calls of all tokens together, so it's replaced by per-token limits
+	vkapi.Limit = 0
+	limiter := newRequestLimiter(vkapi.Handler, policy)
+	vkapi.Handler = limiter.handle
+	return vkapi
+}
+
+type requestLimiter struct {
+	next   apiHandler
+	policy RequestPolicy
+
+	mutex sync.Mutex
+	// the earliest time of the next call by tokens
+	nextRequestTs map[string]time.Time
+}
+
+func newRequestLimiter(next apiHandler, policy RequestPolicy) *requestLimiter {
+	return &requestLimiter{
+		next:          next,
+		policy:        policy,
+		nextRequestTs: make(map[string]time.Time),
+	}
+}
+
+func (limiter *requestLimiter) handle(method string, params ...api.Params) (api.Response, error) {
+	ctx := getContext(params)
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), limiter.policy.RequestTimeout)
+		defer cancel()
+		params = append(append([]api.Params{}, params...), api.Params{":context": ctx})
+	}
+
+	token := getAccessToken(params)
+	for attempt := 0; ; attempt++ {
+		err := sleepContext(ctx, limiter.reserve(token))
+		if err != nil {
+			return api.Response{}, err
+		}
+
+		response, err := limiter.next(method, params...)
+		if err == nil || !IsTransientError(err) || attempt >= limiter.policy.MaxRetries {
+			return response, err
+		}
+
+		backoff := getJitteredBackoff(limiter.policy.BaseBackoff, limiter.policy.MaxBackoff, attempt)
+		logging.Log.Warn(logPackage, "requestLimiter.handle", "%s is failed by a transient error, retry in %s: %s", method, backoff, err)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return response, err
+		}
+	}
+}
+
+// reserve reserves the next call for a token and returns how long to wait for it
+func (limiter *requestLimiter) reserve(token string) time.Duration {
+	if limiter.policy.RequestsPerSecond <= 0 {
+		return 0
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	requestTs := limiter.nextRequestTs[token]
+	if requestTs.Before(now) {
+		requestTs = now
+	}
+	limiter.nextRequestTs[token] = requestTs.Add(time.Second / time.Duration(limiter.policy.RequestsPerSecond))
+
+	return requestTs.Sub(now)
+}
+
+// getJitteredBackoff doubles a backoff for every attempt and picks a random one between its half and itself,
+// so retries of simultaneous calls don't hit the api at the same time
+func getJitteredBackoff(baseBackoff, maxBackoff time.Duration, attempt int) time.Duration {
+	backoff := baseBackoff << attempt
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+
+	half := int64(backoff / 2)
+	if half == 0 {
+		return backoff
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// getContext returns a context passed by a caller (see api.Params.WithContext)
+func getContext(params []api.Params) context.Context {
+	for index := len(params) - 1; index >= 0; index-- {
+		if ctx, ok := params[index][":context"].(context.Context); ok {
+			return ctx
+		}
+	}
+	return nil
+}
+
+// getAccessToken returns a token of a call, the latest params override the previous ones
+func getAccessToken(params []api.Params) string {
+	for index := len(params) - 1; index >= 0; index-- {
+		if token, ok := params[index]["access_token"].(string); ok {
+			return token
+		}
+	}
+	return ""
+}
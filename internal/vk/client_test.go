@@ -0,0 +1,58 @@
+package vk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+func TestGetJitteredBackoff(t *testing.T) {
+	baseBackoff := 100 * time.Millisecond
+	maxBackoff := time.Second
+
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		actual := getJitteredBackoff(baseBackoff, maxBackoff, attempt)
+		if actual < expected/2 || actual > expected {
+			t.Errorf("Incorrect result. Actual: %v, Expected: between %v and %v", actual, expected/2, expected)
+		}
+	}
+}
+
+func TestRequestLimiterRetries(t *testing.T) {
+	policy := RequestPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, RequestTimeout: time.Second}
+
+	calls := 0
+	limiter := newRequestLimiter(func(method string, params ...api.Params) (api.Response, error) {
+		calls++
+		return api.Response{}, &api.Error{Code: api.ErrFlood}
+	}, policy)
+	_, err := limiter.handle("wall.get")
+	if err == nil || calls != 3 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", calls, 3)
+	}
+
+	calls = 0
+	limiter = newRequestLimiter(func(method string, params ...api.Params) (api.Response, error) {
+		calls++
+		return api.Response{}, &api.Error{Code: api.ErrAuth}
+	}, policy)
+	_, err = limiter.handle("wall.get")
+	if err == nil || calls != 1 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", calls, 1)
+	}
+}
+
+func TestRequestLimiterRespectsDeadline(t *testing.T) {
+	policy := RequestPolicy{MaxRetries: 10, BaseBackoff: time.Second, MaxBackoff: time.Second, RequestTimeout: 50 * time.Millisecond}
+
+	limiter := newRequestLimiter(func(method string, params ...api.Params) (api.Response, error) {
+		return api.Response{}, &api.Error{Code: api.ErrTooMany}
+	}, policy)
+
+	startTs := time.Now()
+	_, err := limiter.handle("wall.get")
+	if err == nil || time.Since(startTs) > 500*time.Millisecond {
+		t.Errorf("Incorrect result. Actual: %v, Expected: a deadline error within %v", time.Since(startTs), policy.RequestTimeout)
+	}
+}
@@ -2,12 +2,32 @@ package content
 
 import (
 	"chattweiler/internal/vk"
+	"fmt"
+
 	"github.com/SevereCloud/vksdk/v2/object"
 )
 
 type MediaAttachment struct {
 	Type vk.MediaAttachmentType
 	Data *object.WallWallpostAttachment
+
+	// where the attachment is taken from, nil if it's unknown
+	Source *Origin
+}
+
+// Origin a wall post or an album which content is taken from
+type Origin struct {
+	OwnerID int
+	URL     string
+	Text    string
+}
+
+func NewWallPostOrigin(post *object.WallWallpost) *Origin {
+	return &Origin{
+		OwnerID: post.OwnerID,
+		URL:     fmt.Sprintf("https://vk.com/wall%d_%d", post.OwnerID, post.ID),
+		Text:    post.Text,
+	}
 }
 
 type AttachmentsContentCollector interface {
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/vk"
+	"chattweiler/internal/vk/content"
+	"fmt"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// isContentSourceCompatible tells whether the source is able to provide attachments of such type.
+// Walls contain any kind of attachments, but albums and playlists contain only their own
+func isContentSourceCompatible(source model.ContentSource, attachmentType vk.MediaAttachmentType) bool {
+	switch source.Kind {
+	case model.WallSource:
+		return true
+	case model.PhotoAlbumSource:
+		return attachmentType == vk.PhotoType
+	case model.VideoAlbumSource:
+		return attachmentType == vk.VideoType
+	case model.AudioPlaylistSource:
+		return attachmentType == vk.AudioType
+	}
+
+	return false
+}
+
+func getContentSourceSize(client *api.VK, source *model.ContentSource) (int, error) {
+	switch source.Kind {
+	case model.PhotoAlbumSource:
+		return vk.GetPhotoAlbumSize(client, source.OwnerID, source.AlbumID)
+	case model.VideoAlbumSource:
+		return vk.GetVideoAlbumSize(client, source.OwnerID, source.AlbumID)
+	case model.AudioPlaylistSource:
+		return vk.GetAudioPlaylistSize(client, source.OwnerID, source.AlbumID)
+	}
+
+	return vk.GetWallPostsCount(client, source.Domain)
+}
+
+func getMaxContentFetchBound(kind model.ContentSourceKind) int {
+	switch kind {
+	case model.PhotoAlbumSource:
+		// https://dev.vk.com/method/photos.get#count parameters' constraints
+		return 1000
+	case model.VideoAlbumSource:
+		// https://dev.vk.com/method/video.get#count parameters' constraints
+		return 200
+	case model.AudioPlaylistSource:
+		return 200
+	}
+
+	// https://dev.vk.com/method/wall.get#count parameters' constraints
+	return 100
+}
+
+// fetchAlbumContentSequence fetches a sequence of album's items
+// wrapped into wall attachments, so they can be delivered the same way as wall content
+func fetchAlbumContentSequence(
+	client *api.VK,
+	attachmentType vk.MediaAttachmentType,
+	source *model.ContentSource,
+	offset,
+	count int,
+) ([]content.MediaAttachment, error) {
+	var attachments []content.MediaAttachment
+
+	switch source.Kind {
+	case model.PhotoAlbumSource:
+		response, err := client.PhotosGet(api.Params{
+			"owner_id": source.OwnerID,
+			"album_id": source.AlbumID,
+			"count":    count,
+			"offset":   offset,
+		})
+		if err != nil {
+			logging.Log.Error(logPackage, "fetchAlbumContentSequence", err, "empty content sequence. source=%s", source)
+			return []content.MediaAttachment{}, err
+		}
+
+		for _, photo := range response.Items {
+			attachments = append(attachments, content.MediaAttachment{
+				Type: vk.PhotoType,
+				Data: &object.WallWallpostAttachment{
+					Type:  string(vk.PhotoType),
+					Photo: photo,
+				},
+				Source: &content.Origin{
+					OwnerID: photo.OwnerID,
+					URL:     "https://vk.com/" + photo.ToAttachment(),
+					Text:    photo.Text,
+				},
+			})
+		}
+	case model.VideoAlbumSource:
+		response, err := client.VideoGet(api.Params{
+			"owner_id": source.OwnerID,
+			"album_id": source.AlbumID,
+			"count":    count,
+			"offset":   offset,
+		})
+		if err != nil {
+			logging.Log.Error(logPackage, "fetchAlbumContentSequence", err, "empty content sequence. source=%s", source)
+			return []content.MediaAttachment{}, err
+		}
+
+		for _, video := range response.Items {
+			attachment := object.WallWallpostAttachment{
+				Type:  string(vk.VideoType),
+				Video: video,
+			}
+			if isSharingEnabled(attachmentType, attachment) {
+				attachments = append(attachments, content.MediaAttachment{
+					Type: vk.VideoType,
+					Data: &attachment,
+					Source: &content.Origin{
+						OwnerID: video.OwnerID,
+						URL:     "https://vk.com/" + video.ToAttachment(),
+						Text:    video.Title,
+					},
+				})
+			}
+		}
+	case model.AudioPlaylistSource:
+		response, err := vk.AudioGet(client, api.Params{
+			"owner_id":    source.OwnerID,
+			"playlist_id": source.AlbumID,
+			"count":       count,
+			"offset":      offset,
+		})
+		if err != nil {
+			logging.Log.Error(logPackage, "fetchAlbumContentSequence", err, "empty content sequence. source=%s", source)
+			return []content.MediaAttachment{}, err
+		}
+
+		playlistURL := fmt.Sprintf("https://vk.com/music/playlist/%d_%s", source.OwnerID, source.AlbumID)
+		for _, audio := range response.Items {
+			attachments = append(attachments, content.MediaAttachment{
+				Type: vk.AudioType,
+				Data: &object.WallWallpostAttachment{
+					Type:  string(vk.AudioType),
+					Audio: audio,
+				},
+				Source: &content.Origin{
+					OwnerID: source.OwnerID,
+					URL:     playlistURL,
+				},
+			})
+		}
+	}
+
+	return attachments, nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"chattweiler/internal/vk/content"
+	"strings"
+)
+
+// buildContentCaption fills a caption template with information about content's origin.
+// Supported placeholders: %post_url%, %community_name%, %post_text%
+func buildContentCaption(template string, origin *content.Origin, communityName string, maxTextLength int) string {
+	return strings.NewReplacer(
+		"%post_url%", origin.URL,
+		"%community_name%", communityName,
+		"%post_text%", trimText(origin.Text, maxTextLength),
+	).Replace(template)
+}
+
+func trimText(text string, maxLength int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= maxLength {
+		return string(runes)
+	}
+
+	return strings.TrimSpace(string(runes[:maxLength])) + "…"
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"chattweiler/internal/vk/content"
+	"testing"
+)
+
+func TestBuildContentCaption(t *testing.T) {
+	origin := &content.Origin{
+		OwnerID: -1,
+		URL:     "https://vk.com/wall-1_2",
+		Text:    "Привет, мир",
+	}
+
+	expected := "Jazz: https://vk.com/wall-1_2\nПривет…"
+	actual := buildContentCaption("%community_name%: %post_url%\n%post_text%", origin, "Jazz", 6)
+	if expected != actual {
+		t.Errorf("Incorrect result. Actual: %s, Expected: %s", actual, expected)
+	}
+}
+
+func TestBuildContentCaptionWithShortText(t *testing.T) {
+	origin := &content.Origin{Text: "short"}
+
+	expected := "short"
+	actual := buildContentCaption("%post_text%", origin, "", 200)
+	if expected != actual {
+		t.Errorf("Incorrect result. Actual: %s, Expected: %s", actual, expected)
+	}
+}
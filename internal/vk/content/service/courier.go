@@ -2,11 +2,16 @@ package service
 
 import (
 	botobject "chattweiler/internal/bot/object"
+	"chattweiler/internal/localization"
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository"
 	"chattweiler/internal/repository/model"
+	"chattweiler/internal/roulette"
+	"chattweiler/internal/templating"
 	"chattweiler/internal/vk"
 	"chattweiler/internal/vk/content"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
@@ -16,10 +21,22 @@ import (
 type MediaContentCourier struct {
 	communityVkApi          *api.VK
 	userVkApi               *api.VK
+	outbox                  *vk.Outbox
+	profiles                *vk.UserProfileCache
+	locales                 *localization.ChatLocales
+	phraseSelector          roulette.Selector
 	phrasesRepo             repository.PhraseRepository
 	contentCommandRepo      repository.CommandsRepository
+	contentCursorRepo       repository.ContentCursorRepository
 	listeningChannel        chan *botobject.ContentRequestCommand
 	commandCollectors       map[int]content.AttachmentsContentCollector
+	commandCollectorModes   map[int]model.ContentMode
+	searchCollectors        map[searchCollectorKey]*CachedSearchAttachmentsContentCollector
+	searchCacheExpiration   time.Duration
+	sourcesHealth           *ContentSourceHealthTracker
+	communityNames          map[int]string
+	captionTextMaxLength    int
+	wallWindows             int
 	garbageCleaningInterval time.Duration
 	lastTsGarbageCollected  time.Time
 }
@@ -27,18 +44,39 @@ type MediaContentCourier struct {
 func NewMediaContentCourier(
 	communityVkApi,
 	userVkApi *api.VK,
+	outbox *vk.Outbox,
+	profiles *vk.UserProfileCache,
+	locales *localization.ChatLocales,
+	phraseSelector roulette.Selector,
 	phrasesRepo repository.PhraseRepository,
 	contentCommandRepo repository.CommandsRepository,
+	contentCursorRepo repository.ContentCursorRepository,
 	listeningChannel chan *botobject.ContentRequestCommand,
 	garbageCleaningInterval time.Duration,
+	searchCacheExpiration time.Duration,
+	sourcesHealth *ContentSourceHealthTracker,
+	captionTextMaxLength int,
+	wallWindows int,
 ) *MediaContentCourier {
 	return &MediaContentCourier{
 		communityVkApi:          communityVkApi,
 		userVkApi:               userVkApi,
+		outbox:                  outbox,
+		profiles:                profiles,
+		locales:                 locales,
+		phraseSelector:          phraseSelector,
 		phrasesRepo:             phrasesRepo,
 		contentCommandRepo:      contentCommandRepo,
+		contentCursorRepo:       contentCursorRepo,
 		listeningChannel:        listeningChannel,
 		commandCollectors:       make(map[int]content.AttachmentsContentCollector),
+		commandCollectorModes:   make(map[int]model.ContentMode),
+		searchCollectors:        make(map[searchCollectorKey]*CachedSearchAttachmentsContentCollector),
+		searchCacheExpiration:   searchCacheExpiration,
+		sourcesHealth:           sourcesHealth,
+		communityNames:          make(map[int]string),
+		captionTextMaxLength:    captionTextMaxLength,
+		wallWindows:             wallWindows,
 		lastTsGarbageCollected:  time.Now(),
 		garbageCleaningInterval: garbageCleaningInterval,
 	}
@@ -48,24 +86,26 @@ func (courier *MediaContentCourier) ReceiveAndDeliver() {
 	for {
 		select {
 		case received := <-courier.listeningChannel:
-			user, err := vk.GetUserInfo(courier.communityVkApi, received.Event.UserID)
+			user, err := courier.profiles.Get(received.Event.UserID)
 			if err != nil {
 				logging.Log.Error(logPackage, "MediaContentCourier.ReceiveAndDeliver", err, "%s: get user info error", received.Event.UserID)
 				continue
 			}
 
-			if _, alreadyExists := courier.commandCollectors[received.Command.ID]; !alreadyExists {
-				courier.createNewCollectorForCommand(received)
-			}
-
 			if courier.lastTsGarbageCollected.Add(courier.garbageCleaningInterval).Before(time.Now()) {
 				courier.removeGarbageCollectors()
 			}
 
-			mediaAttachment := courier.commandCollectors[received.Command.ID].CollectOne()
+			collector := courier.getCollectorForRequest(received)
+			mediaAttachment := collector.CollectOne()
 			if mediaAttachment == nil || len(mediaAttachment.Type) == 0 {
 				logging.Log.Warn(logPackage, "MediaContentCourier.ReceiveAndDeliver", "collected empty media content ignored")
-				courier.askToRetryRequest(received, user)
+				// a user is asked to retry his search if nothing is found because of vk api errors
+				if searchCollector, isSearch := collector.(*CachedSearchAttachmentsContentCollector); isSearch && !searchCollector.IsSearchFailed() {
+					courier.replyContentNotFound(received, user)
+				} else {
+					courier.askToRetryRequest(received, user)
+				}
 				continue
 			}
 
@@ -79,49 +119,163 @@ func (courier *MediaContentCourier) deliverContentResponse(
 	user *object.UsersUser,
 	mediaContent *content.MediaAttachment,
 ) {
-	phrases := courier.phrasesRepo.FindAllByType(model.ContentRequestType)
+	phrases := courier.phrasesRepo.FindAllByType(model.ContentRequestType, courier.locales.GetChatLocale(request.Event.PeerID))
 
 	var messageToSend api.Params
 	if len(phrases) == 0 {
 		messageToSend = vk.BuildDirectedMessage(request.Event.PeerID)
 	} else {
-		messageToSend = vk.BuildMessageUsingPersonalizedPhrase(request.Event.PeerID, user, phrases)
+		messageToSend = vk.BuildMessageUsingPersonalizedPhrase(courier.phraseSelector, request.Event.PeerID, user, phrases, courier.newPhraseData(request))
+	}
+
+	captionTemplate := request.Command.ContentDescriptor.CaptionTemplate
+	if len(captionTemplate) != 0 && mediaContent.Source != nil {
+		caption := buildContentCaption(captionTemplate, mediaContent.Source, courier.getCommunityName(mediaContent.Source.OwnerID), courier.captionTextMaxLength)
+		if message, hasMessage := messageToSend["message"]; hasMessage {
+			messageToSend["message"] = fmt.Sprintf("%s\n\n%s", message, caption)
+		} else {
+			messageToSend["message"] = caption
+		}
 	}
 
 	messageToSend["attachment"] = courier.resolveAttachmentID(mediaContent)
-	_, err := courier.communityVkApi.MessagesSend(messageToSend)
+
+	// a user is asked to retry his request if the content isn't delivered,
+	// the message is built only then, so an unsent phrase doesn't get into the selector's history
+	buildFallbackMessage := func() api.Params {
+		retryPhrases := courier.phrasesRepo.FindAllByType(model.RetryType, courier.locales.GetChatLocale(request.Event.PeerID))
+		if len(retryPhrases) == 0 {
+			return nil
+		}
+		return vk.BuildMessageUsingPersonalizedPhrase(courier.phraseSelector, request.Event.PeerID, user, retryPhrases, courier.newPhraseData(request))
+	}
+
+	err := courier.outbox.EnqueueWithFallback(messageToSend, buildFallbackMessage)
 	if err != nil {
-		logging.Log.Error(logPackage, "MediaContentCourier.deliverContentResponse", err, "message sending error. Sent params: %v", messageToSend)
-		courier.askToRetryRequest(request, user)
+		logging.Log.Error(logPackage, "MediaContentCourier.deliverContentResponse", err, "message enqueuing error. Params: %v", messageToSend)
 	}
 }
 
+func (courier *MediaContentCourier) getCollectorForRequest(request *botobject.ContentRequestCommand) content.AttachmentsContentCollector {
+	if len(request.Query) != 0 {
+		key := searchCollectorKey{
+			commandID: request.Command.ID,
+			query:     strings.ToLower(request.Query),
+		}
+
+		if collector, alreadyExists := courier.searchCollectors[key]; alreadyExists && !collector.IsExpired() {
+			return collector
+		}
+
+		courier.searchCollectors[key] = NewCachedSearchAttachmentsContentCollector(
+			courier.userVkApi,
+			request.GetAttachmentsTypes(),
+			request.Command.ID,
+			courier.contentCommandRepo,
+			request.Query,
+			courier.searchCacheExpiration,
+			courier.sourcesHealth,
+		)
+		return courier.searchCollectors[key]
+	}
+
+	// a collector is recreated if command's mode is changed
+	collectorMode, alreadyExists := courier.commandCollectorModes[request.Command.ID]
+	if !alreadyExists || collectorMode != request.Command.ContentDescriptor.Mode {
+		courier.createNewCollectorForCommand(request)
+	}
+
+	return courier.commandCollectors[request.Command.ID]
+}
+
 func (courier *MediaContentCourier) createNewCollectorForCommand(request *botobject.ContentRequestCommand) {
-	courier.commandCollectors[request.Command.ID] = NewCachedRandomAttachmentsContentCollector(
-		courier.userVkApi,
-		request.GetAttachmentsTypes(),
-		request.Command.ID,
-		courier.contentCommandRepo,
-	)
+	mode := request.Command.ContentDescriptor.Mode
+	switch mode {
+	case model.LatestMode, model.TopMode, model.SequentialMode:
+		courier.commandCollectors[request.Command.ID] = NewOrderedAttachmentsContentCollector(
+			courier.userVkApi,
+			request.GetAttachmentsTypes(),
+			request.Command.ID,
+			courier.contentCommandRepo,
+			courier.contentCursorRepo,
+			courier.sourcesHealth,
+			mode,
+		)
+	default:
+		courier.commandCollectors[request.Command.ID] = NewCachedRandomAttachmentsContentCollector(
+			courier.userVkApi,
+			request.GetAttachmentsTypes(),
+			request.Command.ID,
+			courier.contentCommandRepo,
+			courier.sourcesHealth,
+			courier.wallWindows,
+		)
+	}
+	courier.commandCollectorModes[request.Command.ID] = mode
 }
 
 func (courier *MediaContentCourier) askToRetryRequest(
 	request *botobject.ContentRequestCommand,
 	user *object.UsersUser,
 ) {
-	phrases := courier.phrasesRepo.FindAllByType(model.RetryType)
+	phrases := courier.phrasesRepo.FindAllByType(model.RetryType, courier.locales.GetChatLocale(request.Event.PeerID))
 	if len(phrases) == 0 {
 		logging.Log.Warn(logPackage, "MediaContentCourier.askToRetryRequest", "there's no ask retry phrases, message won't be sent")
 		return
 	}
 
-	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(request.Event.PeerID, user, phrases)
-	_, err := courier.communityVkApi.MessagesSend(messageToSend)
+	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(courier.phraseSelector, request.Event.PeerID, user, phrases, courier.newPhraseData(request))
+	err := courier.outbox.Enqueue(messageToSend)
+	if err != nil {
+		logging.Log.Error(logPackage, "MediaContentCourier.askToRetryRequest", err, "message enqueuing error. Params: %v", messageToSend)
+	}
+}
+
+func (courier *MediaContentCourier) replyContentNotFound(
+	request *botobject.ContentRequestCommand,
+	user *object.UsersUser,
+) {
+	phrases := courier.phrasesRepo.FindAllByType(model.ContentNotFoundType, courier.locales.GetChatLocale(request.Event.PeerID))
+	if len(phrases) == 0 {
+		logging.Log.Warn(logPackage, "MediaContentCourier.replyContentNotFound", "there's no content not found phrases, message won't be sent")
+		return
+	}
+
+	messageToSend := vk.BuildMessageUsingPersonalizedPhrase(courier.phraseSelector, request.Event.PeerID, user, phrases, courier.newPhraseData(request))
+	err := courier.outbox.Enqueue(messageToSend)
 	if err != nil {
-		logging.Log.Error(logPackage, "MediaContentCourier.askToRetryRequest", err, "message sending error. Sent params: %v", messageToSend)
+		logging.Log.Error(logPackage, "MediaContentCourier.replyContentNotFound", err, "message enqueuing error. Params: %v", messageToSend)
 	}
 }
 
+// newPhraseData creates data for phrases of a request, a query of a content command is available as its arguments
+func (courier *MediaContentCourier) newPhraseData(request *botobject.ContentRequestCommand) *templating.Data {
+	data := vk.NewPhraseData(courier.communityVkApi, courier.locales, request.Event.PeerID)
+	data.Args = request.Query
+	return data
+}
+
+// getCommunityName resolves and caches names of communities which content comes from
+func (courier *MediaContentCourier) getCommunityName(ownerID int) string {
+	// positive owners are users, not communities
+	if ownerID >= 0 {
+		return ""
+	}
+
+	if name, exists := courier.communityNames[ownerID]; exists {
+		return name
+	}
+
+	name, err := vk.GetCommunityName(courier.communityVkApi, -ownerID)
+	if err != nil {
+		logging.Log.Error(logPackage, "MediaContentCourier.getCommunityName", err, "vk api error")
+		return ""
+	}
+
+	courier.communityNames[ownerID] = name
+	return name
+}
+
 func (courier *MediaContentCourier) resolveAttachmentID(mediaContent *content.MediaAttachment) string {
 	switch mediaContent.Type {
 	case vk.AudioType:
@@ -130,6 +284,12 @@ func (courier *MediaContentCourier) resolveAttachmentID(mediaContent *content.Me
 		return mediaContent.Data.Photo.ToAttachment()
 	case vk.VideoType:
 		return mediaContent.Data.Video.ToAttachment()
+	case vk.DocumentType:
+		// documents from walls could be private, so they're not shareable without access key
+		if len(mediaContent.Data.Doc.AccessKey) != 0 {
+			return fmt.Sprintf("%s_%s", mediaContent.Data.Doc.ToAttachment(), mediaContent.Data.Doc.AccessKey)
+		}
+		return mediaContent.Data.Doc.ToAttachment()
 	}
 
 	return ""
@@ -145,6 +305,13 @@ func (courier *MediaContentCourier) removeGarbageCollectors() {
 	for commandID := range courier.commandCollectors {
 		if _, exist := relevantCommandsMap[commandID]; !exist {
 			delete(courier.commandCollectors, commandID)
+			delete(courier.commandCollectorModes, commandID)
+		}
+	}
+
+	for key, collector := range courier.searchCollectors {
+		if _, exist := relevantCommandsMap[key.commandID]; !exist || collector.IsExpired() {
+			delete(courier.searchCollectors, key)
 		}
 	}
 }
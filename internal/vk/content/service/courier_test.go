@@ -0,0 +1,30 @@
+package service
+
+import (
+	"chattweiler/internal/vk"
+	"chattweiler/internal/vk/content"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+func TestResolveDocumentAttachmentID(t *testing.T) {
+	tests := []struct {
+		doc      object.DocsDoc
+		expected string
+	}{
+		{object.DocsDoc{ID: 456, OwnerID: -123}, "doc-123_456"},
+		// private documents of walls are shared with their access key
+		{object.DocsDoc{ID: 456, OwnerID: -123, AccessKey: "0a1b2c"}, "doc-123_456_0a1b2c"},
+	}
+
+	courier := &MediaContentCourier{}
+	for _, test := range tests {
+		attachment := &content.MediaAttachment{Type: vk.DocumentType, Data: &object.WallWallpostAttachment{Doc: test.doc}}
+
+		actual := courier.resolveAttachmentID(attachment)
+		if actual != test.expected {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, test.expected)
+		}
+	}
+}
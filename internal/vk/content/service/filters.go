@@ -0,0 +1,41 @@
+package service
+
+import (
+	"chattweiler/internal/repository/model"
+	"strings"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// isWallPostAccepted tells whether a wall post passes command's restrictions
+func isWallPostAccepted(post *object.WallWallpost, filter *model.PostFilter, now time.Time) bool {
+	if post.Likes.Count < filter.MinLikes ||
+		post.Reposts.Count < filter.MinReposts ||
+		post.Views.Count < filter.MinViews {
+		return false
+	}
+
+	if filter.MaxPostAge > 0 && time.Unix(int64(post.Date), 0).Before(now.Add(-filter.MaxPostAge)) {
+		return false
+	}
+
+	if filter.ExcludePinned && bool(post.IsPinned) {
+		return false
+	}
+
+	if filter.ExcludeAds && bool(post.MarkedAsAds) {
+		return false
+	}
+
+	if len(filter.TextBlocklist) != 0 {
+		text := strings.ToLower(post.Text)
+		for _, word := range filter.TextBlocklist {
+			if strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"chattweiler/internal/repository/model"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+func TestWallPostAcceptedWithEmptyFilter(t *testing.T) {
+	post := object.WallWallpost{}
+
+	if !isWallPostAccepted(&post, &model.PostFilter{}, time.Now()) {
+		t.Errorf("Post is expected to be accepted with empty filter")
+	}
+}
+
+func TestWallPostFilteredByPopularity(t *testing.T) {
+	post := object.WallWallpost{}
+	post.Likes.Count = 10
+	post.Views.Count = 1000
+
+	if isWallPostAccepted(&post, &model.PostFilter{MinLikes: 11}, time.Now()) {
+		t.Errorf("Post with less likes is expected to be filtered")
+	}
+
+	if !isWallPostAccepted(&post, &model.PostFilter{MinLikes: 10, MinViews: 1000}, time.Now()) {
+		t.Errorf("Post with enough likes and views is expected to be accepted")
+	}
+}
+
+func TestWallPostFilteredByAge(t *testing.T) {
+	now := time.Now()
+	post := object.WallWallpost{}
+	post.Date = int(now.Add(-48 * time.Hour).Unix())
+
+	if isWallPostAccepted(&post, &model.PostFilter{MaxPostAge: 24 * time.Hour}, now) {
+		t.Errorf("Older post is expected to be filtered")
+	}
+
+	if !isWallPostAccepted(&post, &model.PostFilter{MaxPostAge: 72 * time.Hour}, now) {
+		t.Errorf("Newer post is expected to be accepted")
+	}
+}
+
+func TestWallPostFilteredByFlagsAndText(t *testing.T) {
+	post := object.WallWallpost{}
+	post.IsPinned = true
+	post.Text = "Buy Our Merch"
+
+	if isWallPostAccepted(&post, &model.PostFilter{ExcludePinned: true}, time.Now()) {
+		t.Errorf("Pinned post is expected to be filtered")
+	}
+
+	if isWallPostAccepted(&post, &model.PostFilter{TextBlocklist: []string{"merch"}}, time.Now()) {
+		t.Errorf("Post with blocked word is expected to be filtered")
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository/model"
+	"sync"
+	"time"
+)
+
+type sourceHealth struct {
+	consecutiveFailures int
+	excludedUntil       time.Time
+}
+
+// ContentSourceHealthTracker is a circuit breaker for content sources.
+// A source which fails several times in a row is excluded
+// from selection for a cooldown period, after that it gets another chance
+type ContentSourceHealthTracker struct {
+	failureThreshold int
+	cooldownPeriod   time.Duration
+	mutex            sync.Mutex
+	sources          map[string]*sourceHealth
+}
+
+func NewContentSourceHealthTracker(failureThreshold int, cooldownPeriod time.Duration) *ContentSourceHealthTracker {
+	return &ContentSourceHealthTracker{
+		failureThreshold: failureThreshold,
+		cooldownPeriod:   cooldownPeriod,
+		sources:          make(map[string]*sourceHealth),
+	}
+}
+
+func (tracker *ContentSourceHealthTracker) IsAvailable(source model.ContentSource) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	health, exists := tracker.sources[source.String()]
+	if !exists {
+		return true
+	}
+
+	return time.Now().After(health.excludedUntil)
+}
+
+func (tracker *ContentSourceHealthTracker) ReportSuccess(source model.ContentSource) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	delete(tracker.sources, source.String())
+}
+
+func (tracker *ContentSourceHealthTracker) ReportFailure(source model.ContentSource) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	health, exists := tracker.sources[source.String()]
+	if !exists {
+		health = &sourceHealth{}
+		tracker.sources[source.String()] = health
+	}
+
+	health.consecutiveFailures++
+	if health.consecutiveFailures >= tracker.failureThreshold {
+		health.consecutiveFailures = 0
+		health.excludedUntil = time.Now().Add(tracker.cooldownPeriod)
+		logging.Log.Warn(logPackage, "ContentSourceHealthTracker.ReportFailure", "content source '%s' is excluded until %s", source, health.excludedUntil.Format(time.RFC3339))
+	}
+}
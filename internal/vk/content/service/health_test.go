@@ -0,0 +1,45 @@
+package service
+
+import (
+	"chattweiler/internal/repository/model"
+	"testing"
+	"time"
+)
+
+func TestContentSourceExcludedAfterFailures(t *testing.T) {
+	tracker := NewContentSourceHealthTracker(2, time.Hour)
+	source := model.ContentSource{Kind: model.WallSource, Domain: "jazzjazz"}
+
+	tracker.ReportFailure(source)
+	if !tracker.IsAvailable(source) {
+		t.Errorf("Source is expected to be available before failure threshold")
+	}
+
+	tracker.ReportFailure(source)
+	if tracker.IsAvailable(source) {
+		t.Errorf("Source is expected to be excluded after failure threshold")
+	}
+}
+
+func TestContentSourceFailuresResetBySuccess(t *testing.T) {
+	tracker := NewContentSourceHealthTracker(2, time.Hour)
+	source := model.ContentSource{Kind: model.WallSource, Domain: "jazzjazz"}
+
+	tracker.ReportFailure(source)
+	tracker.ReportSuccess(source)
+	tracker.ReportFailure(source)
+	if !tracker.IsAvailable(source) {
+		t.Errorf("Source is expected to be available after success")
+	}
+}
+
+func TestContentSourceAvailableAfterCooldown(t *testing.T) {
+	tracker := NewContentSourceHealthTracker(1, time.Nanosecond)
+	source := model.ContentSource{Kind: model.WallSource, Domain: "jazzjazz"}
+
+	tracker.ReportFailure(source)
+	time.Sleep(time.Millisecond)
+	if !tracker.IsAvailable(source) {
+		t.Errorf("Source is expected to be available after cooldown")
+	}
+}
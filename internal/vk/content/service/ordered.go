@@ -0,0 +1,263 @@
+package service
+
+import (
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository"
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/roulette"
+	"chattweiler/internal/utils"
+	"chattweiler/internal/vk"
+	"chattweiler/internal/vk/content"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// OrderedAttachmentsContentCollector collects content from community walls in a specific order:
+// the newest posts (latest mode), the most liked posts for a period (top mode)
+// or all posts one by one from the oldest one (sequential mode)
+type OrderedAttachmentsContentCollector struct {
+	client            *api.VK
+	contentCommandId  int
+	contentSourceRepo repository.CommandsRepository
+	contentCursorRepo repository.ContentCursorRepository
+	attachmentTypes   []vk.MediaAttachmentType
+	sourcesHealth     *ContentSourceHealthTracker
+	mode              model.ContentMode
+
+	// already delivered posts in latest and top modes
+	seenPosts map[string]bool
+
+	// https://dev.vk.com/method/wall.get#count parameters' constraints
+	maxContentFetchBound int
+
+	// a max number of pages which are walked through to find posts for a top window
+	maxTopWindowPages int
+	maxSeenPosts      int
+}
+
+func NewOrderedAttachmentsContentCollector(
+	client *api.VK,
+	attachmentTypes []vk.MediaAttachmentType,
+	contentCommandId int,
+	contentSourceRepo repository.CommandsRepository,
+	contentCursorRepo repository.ContentCursorRepository,
+	sourcesHealth *ContentSourceHealthTracker,
+	mode model.ContentMode,
+) *OrderedAttachmentsContentCollector {
+	return &OrderedAttachmentsContentCollector{
+		client:               client,
+		contentCommandId:     contentCommandId,
+		contentSourceRepo:    contentSourceRepo,
+		contentCursorRepo:    contentCursorRepo,
+		attachmentTypes:      attachmentTypes,
+		sourcesHealth:        sourcesHealth,
+		mode:                 mode,
+		seenPosts:            make(map[string]bool),
+		maxContentFetchBound: 100,
+		maxTopWindowPages:    5,
+		maxSeenPosts:         1000,
+	}
+}
+
+func (collector *OrderedAttachmentsContentCollector) CollectOne() *content.MediaAttachment {
+	contentCommand := collector.contentSourceRepo.FindById(collector.contentCommandId)
+	if contentCommand == nil {
+		return nil
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	attachmentType := collector.attachmentTypes[rand.Intn(len(collector.attachmentTypes))]
+
+	// failed sources are reported and the rest of them are tried in turn
+	alreadyTriedSources := make(map[string]bool)
+	for {
+		source := collector.getWallSource(contentCommand.ContentDescriptor.ContentSources, alreadyTriedSources)
+		if source == nil {
+			logging.Log.Warn(logPackage, "OrderedAttachmentsContentCollector.CollectOne", "there's no available wall source. mode=%s, contentCommandId=%d", collector.mode, collector.contentCommandId)
+			return nil
+		}
+		alreadyTriedSources[source.String()] = true
+
+		var attachment *content.MediaAttachment
+		var err error
+		switch collector.mode {
+		case model.LatestMode:
+			attachment, err = collector.collectLatest(source, attachmentType, &contentCommand.ContentDescriptor)
+		case model.TopMode:
+			attachment, err = collector.collectTop(source, attachmentType, &contentCommand.ContentDescriptor)
+		case model.SequentialMode:
+			attachment, err = collector.collectSequential(source, attachmentType, &contentCommand.ContentDescriptor)
+		}
+
+		if err != nil {
+			logging.Log.Error(logPackage, "OrderedAttachmentsContentCollector.CollectOne", err, "vk api error. source=%s", source)
+			collector.sourcesHealth.ReportFailure(*source)
+			continue
+		}
+
+		collector.sourcesHealth.ReportSuccess(*source)
+		return attachment
+	}
+}
+
+func (collector *OrderedAttachmentsContentCollector) collectLatest(
+	source *model.ContentSource,
+	attachmentType vk.MediaAttachmentType,
+	descriptor *model.ContentDescriptor,
+) (*content.MediaAttachment, error) {
+	response, err := collector.client.WallGet(api.Params{
+		"domain": source.Domain,
+		"count":  collector.maxContentFetchBound,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// a pinned post goes first in a response regardless of its date, so posts are reordered from the newest one
+	posts := response.Items
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date > posts[j].Date
+	})
+
+	return collector.pickUpUnseen(posts, attachmentType, descriptor), nil
+}
+
+func (collector *OrderedAttachmentsContentCollector) collectTop(
+	source *model.ContentSource,
+	attachmentType vk.MediaAttachmentType,
+	descriptor *model.ContentDescriptor,
+) (*content.MediaAttachment, error) {
+	windowStart := time.Now().Add(-descriptor.TopWindow).Unix()
+
+	var posts []object.WallWallpost
+	for page := 0; page < collector.maxTopWindowPages; page++ {
+		response, err := collector.client.WallGet(api.Params{
+			"domain": source.Domain,
+			"count":  collector.maxContentFetchBound,
+			"offset": page * collector.maxContentFetchBound,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		isWindowPassed := len(response.Items) < collector.maxContentFetchBound
+		for _, post := range response.Items {
+			if int64(post.Date) >= windowStart {
+				posts = append(posts, post)
+			} else if !bool(post.IsPinned) {
+				isWindowPassed = true
+			}
+		}
+
+		if isWindowPassed {
+			break
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Likes.Count > posts[j].Likes.Count
+	})
+
+	attachment := collector.pickUpUnseen(posts, attachmentType, descriptor)
+	if attachment == nil && len(collector.seenPosts) != 0 {
+		// all top posts are already delivered, so it's started over
+		collector.seenPosts = make(map[string]bool)
+		attachment = collector.pickUpUnseen(posts, attachmentType, descriptor)
+	}
+
+	return attachment, nil
+}
+
+func (collector *OrderedAttachmentsContentCollector) collectSequential(
+	source *model.ContentSource,
+	attachmentType vk.MediaAttachmentType,
+	descriptor *model.ContentDescriptor,
+) (*content.MediaAttachment, error) {
+	count, err := vk.GetWallPostsCount(collector.client, source.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	// a position of the next post to deliver from the oldest one, it's saved, so it goes on after a restart
+	position, err := collector.contentCursorRepo.FindPosition(collector.contentCommandId, source.String())
+	if err != nil {
+		// a storage failure isn't a failure of the source, nothing is delivered and the position is kept as it is
+		logging.Log.Warn(logPackage, "OrderedAttachmentsContentCollector.collectSequential", "position of source %s isn't available, content isn't collected", source)
+		return nil, nil
+	}
+	if position >= count {
+		// the whole wall is walked through, so it's started over
+		position = 0
+	}
+	defer func() {
+		collector.contentCursorRepo.UpdatePosition(collector.contentCommandId, source.String(), position)
+	}()
+
+	for position < count {
+		// posts are returned from the newest one, so the window is counted from the end of a wall
+		windowEnd := count - position
+		offset := utils.Clamp[int](windowEnd-collector.maxContentFetchBound, 0, count)
+		response, err := collector.client.WallGet(api.Params{
+			"domain": source.Domain,
+			"count":  windowEnd - offset,
+			"offset": offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(response.Items) == 0 {
+			return nil, nil
+		}
+
+		for index := len(response.Items) - 1; index >= 0; index-- {
+			position++
+			attachments := pickUpWallPostsAttachments(response.Items[index:index+1], attachmentType, descriptor, 1)
+			if len(attachments) != 0 {
+				return &attachments[0], nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// pickUpUnseen picks up an attachment of the first post which is not delivered yet
+func (collector *OrderedAttachmentsContentCollector) pickUpUnseen(
+	posts []object.WallWallpost,
+	attachmentType vk.MediaAttachmentType,
+	descriptor *model.ContentDescriptor,
+) *content.MediaAttachment {
+	if len(collector.seenPosts) >= collector.maxSeenPosts {
+		collector.seenPosts = make(map[string]bool)
+	}
+
+	for _, attachment := range pickUpWallPostsAttachments(posts, attachmentType, descriptor, len(posts)) {
+		if !collector.seenPosts[attachment.Source.URL] {
+			collector.seenPosts[attachment.Source.URL] = true
+			return &attachment
+		}
+	}
+
+	return nil
+}
+
+func (collector *OrderedAttachmentsContentCollector) getWallSource(
+	sources []model.ContentSource,
+	excludedSources map[string]bool,
+) *model.ContentSource {
+	var availableSources []model.ContentSource
+	for _, source := range sources {
+		if source.Kind == model.WallSource &&
+			!excludedSources[source.String()] &&
+			collector.sourcesHealth.IsAvailable(source) {
+			availableSources = append(availableSources, source)
+		}
+	}
+
+	return roulette.SpinContentSource(availableSources...)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/vk"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+type fakeCommandsRepository struct {
+	command model.Command
+}
+
+func (repo *fakeCommandsRepository) FindAll() []model.Command {
+	return []model.Command{repo.command}
+}
+
+func (repo *fakeCommandsRepository) FindByCommandAlias(string) *model.Command {
+	return &repo.command
+}
+
+func (repo *fakeCommandsRepository) FindById(int) *model.Command {
+	return &repo.command
+}
+
+type fakeContentCursorRepository struct {
+	positions map[string]int
+	// a storage error of reading, positions aren't available while it's set
+	findErr error
+	updates int
+}
+
+func (repo *fakeContentCursorRepository) FindPosition(commandID int, source string) (int, error) {
+	if repo.findErr != nil {
+		return 0, repo.findErr
+	}
+	return repo.positions[strconv.Itoa(commandID)+source], nil
+}
+
+func (repo *fakeContentCursorRepository) UpdatePosition(commandID int, source string, position int) bool {
+	repo.updates++
+	repo.positions[strconv.Itoa(commandID)+source] = position
+	return true
+}
+
+// newFakeWallApi returns a wall with posts from the newest one as wall.get does, a photo id is equal to a post id
+func newFakeWallApi(posts []object.WallWallpost) *api.VK {
+	vkapi := api.NewVK("")
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		count, _ := strconv.Atoi(api.FmtValue(params[0]["count"], 0))
+		offset, _ := strconv.Atoi(api.FmtValue(params[0]["offset"], 0))
+
+		start := offset
+		if start > len(posts) {
+			start = len(posts)
+		}
+		end := start + count
+		if end > len(posts) {
+			end = len(posts)
+		}
+
+		response, _ := json.Marshal(api.WallGetResponse{Count: len(posts), Items: posts[start:end]})
+		return api.Response{Response: response}, nil
+	}
+	return vkapi
+}
+
+func newPhotoWallPost(id int, date time.Time) object.WallWallpost {
+	post := object.WallWallpost{ID: id, OwnerID: -1, Date: int(date.Unix())}
+	post.Attachments = []object.WallWallpostAttachment{{Type: string(vk.PhotoType), Photo: object.PhotosPhoto{ID: id}}}
+	return post
+}
+
+func newOrderedCollector(vkapi *api.VK, cursors *fakeContentCursorRepository, mode model.ContentMode) *OrderedAttachmentsContentCollector {
+	commands := &fakeCommandsRepository{command: model.Command{
+		ID: 1,
+		ContentDescriptor: model.ContentDescriptor{
+			ContentSources: []model.ContentSource{{Kind: model.WallSource, Domain: "jazzjazz", Weight: 1}},
+			Mode:           mode,
+		},
+	}}
+	return NewOrderedAttachmentsContentCollector(
+		vkapi,
+		[]vk.MediaAttachmentType{vk.PhotoType},
+		1,
+		commands,
+		cursors,
+		NewContentSourceHealthTracker(3, time.Hour),
+		mode,
+	)
+}
+
+func collectPhotoIds(collector *OrderedAttachmentsContentCollector, count int) []int {
+	var ids []int
+	for index := 0; index < count; index++ {
+		attachment := collector.CollectOne()
+		if attachment == nil {
+			ids = append(ids, 0)
+			continue
+		}
+		ids = append(ids, attachment.Data.Photo.ID)
+	}
+	return ids
+}
+
+func TestSequentialCollectorGoesOnFromSavedPosition(t *testing.T) {
+	now := time.Now()
+	var posts []object.WallWallpost
+	for id := 5; id >= 1; id-- {
+		posts = append(posts, newPhotoWallPost(id, now.Add(time.Duration(id)*time.Minute)))
+	}
+	vkapi := newFakeWallApi(posts)
+	cursors := &fakeContentCursorRepository{positions: make(map[string]int)}
+
+	actual := collectPhotoIds(newOrderedCollector(vkapi, cursors, model.SequentialMode), 3)
+	expected := []int{1, 2, 3}
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] || actual[2] != expected[2] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+
+	// a new collector (e.g. after a restart) goes on with the saved position and starts over at the end of the wall
+	actual = collectPhotoIds(newOrderedCollector(vkapi, cursors, model.SequentialMode), 3)
+	expected = []int{4, 5, 1}
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] || actual[2] != expected[2] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
+
+func TestSequentialCollectorKeepsPositionOnStorageFailure(t *testing.T) {
+	now := time.Now()
+	var posts []object.WallWallpost
+	for id := 5; id >= 1; id-- {
+		posts = append(posts, newPhotoWallPost(id, now.Add(time.Duration(id)*time.Minute)))
+	}
+	vkapi := newFakeWallApi(posts)
+	cursors := &fakeContentCursorRepository{positions: map[string]int{"1jazzjazz": 3}}
+
+	// nothing is delivered while positions aren't available, and the saved one isn't overwritten
+	cursors.findErr = errors.New("storage is unavailable")
+	collector := newOrderedCollector(vkapi, cursors, model.SequentialMode)
+	if attachment := collector.CollectOne(); attachment != nil || cursors.updates != 0 || cursors.positions["1jazzjazz"] != 3 {
+		t.Errorf("Incorrect result. Actual: %v %v %v, Expected: %v %v %v", attachment, cursors.updates, cursors.positions, nil, 0, 3)
+	}
+
+	// the walk goes on from the saved position once the storage is available
+	cursors.findErr = nil
+	actual := collectPhotoIds(collector, 1)
+	if len(actual) != 1 || actual[0] != 4 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, []int{4})
+	}
+}
+
+func TestLatestCollectorPutsPinnedPostInOrderOfDate(t *testing.T) {
+	now := time.Now()
+	pinnedPost := newPhotoWallPost(1, now.Add(-time.Hour))
+	pinnedPost.IsPinned = true
+	posts := []object.WallWallpost{pinnedPost, newPhotoWallPost(3, now), newPhotoWallPost(2, now.Add(-time.Minute))}
+	cursors := &fakeContentCursorRepository{positions: make(map[string]int)}
+
+	actual := collectPhotoIds(newOrderedCollector(newFakeWallApi(posts), cursors, model.LatestMode), 4)
+	expected := []int{3, 2, 1, 0}
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] || actual[2] != expected[2] || actual[3] != expected[3] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
@@ -3,6 +3,8 @@ package service
 import (
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository"
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/roulette"
 	"chattweiler/internal/utils"
 	"chattweiler/internal/vk"
 	"chattweiler/internal/vk/content"
@@ -14,12 +16,15 @@ import (
 )
 
 type CachedRandomAttachmentsContentCollector struct {
-	client               *api.VK
-	contentCommandId     int
-	contentSourceRepo    repository.CommandsRepository
-	cachedAttachments    map[vk.MediaAttachmentType][]content.MediaAttachment
-	maxContentFetchBound int
-	attachmentTypes      []vk.MediaAttachmentType
+	client            *api.VK
+	contentCommandId  int
+	contentSourceRepo repository.CommandsRepository
+	cachedAttachments map[vk.MediaAttachmentType][]content.MediaAttachment
+	attachmentTypes   []vk.MediaAttachmentType
+	sourcesHealth     *ContentSourceHealthTracker
+
+	// a number of wall windows fetched per cache refresh
+	wallWindows int
 }
 
 func NewCachedRandomAttachmentsContentCollector(
@@ -27,6 +32,8 @@ func NewCachedRandomAttachmentsContentCollector(
 	attachmentTypes []vk.MediaAttachmentType,
 	contentCommandId int,
 	contentSourceRepo repository.CommandsRepository,
+	sourcesHealth *ContentSourceHealthTracker,
+	wallWindows int,
 ) *CachedRandomAttachmentsContentCollector {
 	return &CachedRandomAttachmentsContentCollector{
 		client:            client,
@@ -34,9 +41,8 @@ func NewCachedRandomAttachmentsContentCollector(
 		contentSourceRepo: contentSourceRepo,
 		cachedAttachments: make(map[vk.MediaAttachmentType][]content.MediaAttachment),
 		attachmentTypes:   attachmentTypes,
-
-		// https://dev.vk.com/method/wall.get#count parameters' constraints
-		maxContentFetchBound: 100,
+		sourcesHealth:     sourcesHealth,
+		wallWindows:       utils.Clamp[int](wallWindows, 1, vk.MaxWallWindows),
 	}
 }
 
@@ -73,20 +79,41 @@ func (collector *CachedRandomAttachmentsContentCollector) getAndRemoveCachedAtta
 
 func (collector *CachedRandomAttachmentsContentCollector) refreshCacheDifference(attachmentType vk.MediaAttachmentType) {
 	contentCommand := collector.contentSourceRepo.FindById(collector.contentCommandId)
-	randomVkCommunity := collector.getCommunity(contentCommand.ContentDescriptor.CommunitySourceIDs)
-
-	count, err := vk.GetWallPostsCount(collector.client, randomVkCommunity)
-	if err != nil {
-		logging.Log.Error(logPackage, "CachedRandomAttachmentsContentCollector.refreshCacheDifference", err, "vk api error")
+	if contentCommand == nil {
+		return
 	}
 
-	randomSequenceFetchOffset := collector.getRandomWallPostsOffset(count, collector.maxContentFetchBound)
-	contentSequence := collector.fetchContentSequence(attachmentType, randomVkCommunity, randomSequenceFetchOffset, collector.maxContentFetchBound)
-	collector.cachedAttachments[attachmentType] = append(collector.cachedAttachments[attachmentType], collector.gatherDifference(contentSequence, attachmentType)...)
+	// failed sources are reported and the rest of them are tried in turn
+	alreadyTriedSources := make(map[string]bool)
+	for {
+		randomContentSource := collector.getContentSource(contentCommand.ContentDescriptor.ContentSources, attachmentType, alreadyTriedSources)
+		if randomContentSource == nil {
+			logging.Log.Warn(logPackage, "CachedRandomAttachmentsContentCollector.refreshCacheDifference", "there's no available content source for attachments. attachmentsType=%s, contentCommandId=%d", attachmentType, collector.contentCommandId)
+			return
+		}
+		alreadyTriedSources[randomContentSource.String()] = true
+
+		contentSequence, count, err := collector.fetchRandomContentSequence(attachmentType, &contentCommand.ContentDescriptor, randomContentSource)
+		if err != nil {
+			logging.Log.Error(logPackage, "CachedRandomAttachmentsContentCollector.refreshCacheDifference", err, "vk api error. source=%s", randomContentSource)
+			collector.sourcesHealth.ReportFailure(*randomContentSource)
+			continue
+		}
+
+		if count == 0 {
+			logging.Log.Warn(logPackage, "CachedRandomAttachmentsContentCollector.refreshCacheDifference", "content source is empty. source=%s", randomContentSource)
+			collector.sourcesHealth.ReportFailure(*randomContentSource)
+			continue
+		}
+
+		collector.sourcesHealth.ReportSuccess(*randomContentSource)
+		collector.cachedAttachments[attachmentType] = append(collector.cachedAttachments[attachmentType], collector.gatherDifference(contentSequence, attachmentType)...)
+		return
+	}
 }
 
 func (collector *CachedRandomAttachmentsContentCollector) gatherDifference(
-	contentSequence []object.WallWallpostAttachment,
+	contentSequence []content.MediaAttachment,
 	attachmentType vk.MediaAttachmentType,
 ) []content.MediaAttachment {
 	alreadyPickedUpContentVector := make([]int, len(contentSequence))
@@ -103,10 +130,7 @@ func (collector *CachedRandomAttachmentsContentCollector) gatherDifference(
 			}
 		}
 
-		collectResult = append(collectResult, content.MediaAttachment{
-			Type: attachmentType,
-			Data: &contentSequence[randomIndex],
-		})
+		collectResult = append(collectResult, contentSequence[randomIndex])
 		alreadyPickedUpContentVector[randomIndex] = 1
 
 		alreadyPickedUpContentCount++
@@ -124,30 +148,69 @@ func (collector *CachedRandomAttachmentsContentCollector) getRandomWallPostsOffs
 	return utils.Clamp[int](randomSequenceFetchOffset, 0, wallPostsCount)
 }
 
-func (collector *CachedRandomAttachmentsContentCollector) fetchContentSequence(
+// fetchRandomContentSequence fetches a sequence of content after a random offset of a source and source's size.
+// Walls are fetched by several windows in a single execute call (from the newest post if posts' age is restricted),
+// albums by size and window calls
+func (collector *CachedRandomAttachmentsContentCollector) fetchRandomContentSequence(
 	attachmentType vk.MediaAttachmentType,
-	community string,
-	offset,
-	count int,
-) []object.WallWallpostAttachment {
-	response, err := collector.client.WallGet(api.Params{
-		"domain": community,
-		"count":  count,
-		"offset": offset,
-	})
-
-	if err != nil {
-		logging.Log.Error(logPackage, "CachedRandomAttachmentsContentCollector.fetchContentSequence", err, "empty content sequence")
-		return []object.WallWallpostAttachment{}
+	descriptor *model.ContentDescriptor,
+	source *model.ContentSource,
+) ([]content.MediaAttachment, int, error) {
+	if source.Kind == model.WallSource {
+		rand.Seed(time.Now().UnixNano())
+		offsetPermille := rand.Intn(1000)
+		if descriptor.PostFilter.MaxPostAge > 0 {
+			// windows after a random offset mostly consist of old posts, which are filtered out,
+			// so recent posts are fetched from the newest one
+			offsetPermille = 0
+		}
+
+		response, err := vk.GetRandomWallWindows(collector.client, source.Domain, collector.wallWindows, offsetPermille)
+		if err != nil {
+			return []content.MediaAttachment{}, 0, err
+		}
+
+		return pickUpWallPostsAttachments(response.Items, attachmentType, descriptor, len(response.Items)), response.Count, nil
+	}
+
+	count, err := getContentSourceSize(collector.client, source)
+	if err != nil || count == 0 {
+		return []content.MediaAttachment{}, count, err
 	}
 
-	var attachments []object.WallWallpostAttachment
-	for _, wallPost := range response.Items {
-		for _, attachment := range wallPost.Attachments {
+	maxContentFetchBound := getMaxContentFetchBound(source.Kind)
+	randomSequenceFetchOffset := collector.getRandomWallPostsOffset(count, maxContentFetchBound)
+	contentSequence, err := fetchAlbumContentSequence(collector.client, attachmentType, source, randomSequenceFetchOffset, maxContentFetchBound)
+	return contentSequence, count, err
+}
+
+// pickUpWallPostsAttachments picks up the first suitable attachment of every accepted wall post
+func pickUpWallPostsAttachments(
+	wallPosts []object.WallWallpost,
+	attachmentType vk.MediaAttachmentType,
+	descriptor *model.ContentDescriptor,
+	count int,
+) []content.MediaAttachment {
+	now := time.Now()
+	var attachments []content.MediaAttachment
+	for postIndex := range wallPosts {
+		wallPost := &wallPosts[postIndex]
+
+		// filtered out posts aren't counted, so they don't take place of relevant content
+		if !isWallPostAccepted(wallPost, &descriptor.PostFilter, now) {
+			continue
+		}
+
+		for attachmentIndex, attachment := range wallPost.Attachments {
 			if attachment.Type == string(attachmentType) &&
 				isSharingEnabled(attachmentType, attachment) &&
+				isDocumentExtensionAllowed(attachmentType, attachment, descriptor) &&
 				len(attachments) < count {
-				attachments = append(attachments, attachment)
+				attachments = append(attachments, content.MediaAttachment{
+					Type:   attachmentType,
+					Data:   &wallPost.Attachments[attachmentIndex],
+					Source: content.NewWallPostOrigin(wallPost),
+				})
 				break
 			}
 		}
@@ -164,7 +227,31 @@ func isSharingEnabled(attachmentsType vk.MediaAttachmentType, attachment object.
 	return true
 }
 
-func (collector *CachedRandomAttachmentsContentCollector) getCommunity(communities []string) string {
-	rand.Seed(time.Now().UnixNano())
-	return communities[rand.Intn(len(communities))]
+func isDocumentExtensionAllowed(
+	attachmentsType vk.MediaAttachmentType,
+	attachment object.WallWallpostAttachment,
+	descriptor *model.ContentDescriptor,
+) bool {
+	switch attachmentsType {
+	case vk.DocumentType:
+		return descriptor.IsDocumentExtensionAllowed(attachment.Doc.Ext)
+	}
+	return true
+}
+
+func (collector *CachedRandomAttachmentsContentCollector) getContentSource(
+	sources []model.ContentSource,
+	attachmentType vk.MediaAttachmentType,
+	excludedSources map[string]bool,
+) *model.ContentSource {
+	var availableSources []model.ContentSource
+	for _, source := range sources {
+		if isContentSourceCompatible(source, attachmentType) &&
+			!excludedSources[source.String()] &&
+			collector.sourcesHealth.IsAvailable(source) {
+			availableSources = append(availableSources, source)
+		}
+	}
+
+	return roulette.SpinContentSource(availableSources...)
 }
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/vk"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+func TestRandomCollectorFetchesNewestPostsWithMaxPostAge(t *testing.T) {
+	var offsetPermilles []string
+	vkapi := api.NewVK("")
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		offsetPermilles = append(offsetPermilles, api.FmtValue(params[0]["offset_permille"], 0))
+		return api.Response{Response: []byte(`{"count": 0, "offset": 0, "items": []}`)}, nil
+	}
+
+	collector := NewCachedRandomAttachmentsContentCollector(vkapi, []vk.MediaAttachmentType{vk.PhotoType}, 1, nil, nil, 1)
+	descriptor := &model.ContentDescriptor{PostFilter: model.PostFilter{MaxPostAge: time.Hour}}
+	source := &model.ContentSource{Kind: model.WallSource, Domain: "jazzjazz"}
+	for attempt := 0; attempt < 10; attempt++ {
+		_, _, _ = collector.fetchRandomContentSequence(vk.PhotoType, descriptor, source)
+	}
+
+	if len(offsetPermilles) == 0 {
+		t.Fatalf("Incorrect result. Actual: %v, Expected: %v", len(offsetPermilles), 10)
+	}
+	for _, offsetPermille := range offsetPermilles {
+		if offsetPermille != "0" {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", offsetPermille, "0")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository"
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/vk"
+	"chattweiler/internal/vk/content"
+	"math/rand"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type searchCollectorKey struct {
+	commandID int
+	query     string
+}
+
+// CachedSearchAttachmentsContentCollector collects content from wall posts
+// which match a query. Found content is cached until the collector expires
+type CachedSearchAttachmentsContentCollector struct {
+	client            *api.VK
+	contentCommandId  int
+	contentSourceRepo repository.CommandsRepository
+	query             string
+	cachedAttachments map[vk.MediaAttachmentType][]content.MediaAttachment
+	attachmentTypes   []vk.MediaAttachmentType
+	sourcesHealth     *ContentSourceHealthTracker
+	expiresAt         time.Time
+
+	// whether the last search found anything, so empty results are cached too.
+	// A search isn't counted if no source answered, so it's repeated on the next request
+	searched bool
+	foundAny bool
+	failed   bool
+
+	// https://dev.vk.com/method/wall.search#count parameters' constraints
+	maxContentFetchBound int
+}
+
+func NewCachedSearchAttachmentsContentCollector(
+	client *api.VK,
+	attachmentTypes []vk.MediaAttachmentType,
+	contentCommandId int,
+	contentSourceRepo repository.CommandsRepository,
+	query string,
+	expiration time.Duration,
+	sourcesHealth *ContentSourceHealthTracker,
+) *CachedSearchAttachmentsContentCollector {
+	return &CachedSearchAttachmentsContentCollector{
+		client:               client,
+		contentCommandId:     contentCommandId,
+		contentSourceRepo:    contentSourceRepo,
+		query:                query,
+		cachedAttachments:    make(map[vk.MediaAttachmentType][]content.MediaAttachment),
+		attachmentTypes:      attachmentTypes,
+		sourcesHealth:        sourcesHealth,
+		expiresAt:            time.Now().Add(expiration),
+		maxContentFetchBound: 100,
+	}
+}
+
+func (collector *CachedSearchAttachmentsContentCollector) IsExpired() bool {
+	return time.Now().After(collector.expiresAt)
+}
+
+func (collector *CachedSearchAttachmentsContentCollector) CollectOne() *content.MediaAttachment {
+	if collector.isCacheEmpty() && (!collector.searched || collector.foundAny) {
+		collector.search()
+	}
+
+	var foundTypes []vk.MediaAttachmentType
+	for _, attachmentType := range collector.attachmentTypes {
+		if len(collector.cachedAttachments[attachmentType]) != 0 {
+			foundTypes = append(foundTypes, attachmentType)
+		}
+	}
+
+	if len(foundTypes) == 0 {
+		logging.Log.Warn(logPackage, "CachedSearchAttachmentsContentCollector.CollectOne", "nothing found. query=%s, contentCommandId=%d", collector.query, collector.contentCommandId)
+		return nil
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	attachmentType := foundTypes[rand.Intn(len(foundTypes))]
+	attachments := collector.cachedAttachments[attachmentType]
+	randomIndex := rand.Intn(len(attachments))
+	attachment := attachments[randomIndex]
+
+	// swap last with random chosen one and cut off the tail of slice
+	attachments[randomIndex] = attachments[len(attachments)-1]
+	collector.cachedAttachments[attachmentType] = attachments[:len(attachments)-1]
+	return &attachment
+}
+
+// IsSearchFailed whether no source answered during the last search, so nothing is found because of vk api errors
+func (collector *CachedSearchAttachmentsContentCollector) IsSearchFailed() bool {
+	return collector.failed
+}
+
+func (collector *CachedSearchAttachmentsContentCollector) isCacheEmpty() bool {
+	for _, attachments := range collector.cachedAttachments {
+		if len(attachments) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (collector *CachedSearchAttachmentsContentCollector) search() {
+	collector.searched = true
+	collector.foundAny = false
+	collector.failed = false
+	contentCommand := collector.contentSourceRepo.FindById(collector.contentCommandId)
+	if contentCommand == nil {
+		return
+	}
+
+	searchableSources := 0
+	answeredSources := 0
+	defer func() {
+		collector.failed = searchableSources != 0 && answeredSources == 0
+		collector.searched = !collector.failed
+	}()
+
+	for _, source := range contentCommand.ContentDescriptor.ContentSources {
+		// only walls are searchable
+		if source.Kind != model.WallSource {
+			continue
+		}
+
+		searchableSources++
+		if !collector.sourcesHealth.IsAvailable(source) {
+			continue
+		}
+
+		response, err := collector.client.WallSearch(api.Params{
+			"domain":      source.Domain,
+			"query":       collector.query,
+			"owners_only": 1,
+			"count":       collector.maxContentFetchBound,
+		})
+		if err != nil {
+			logging.Log.Error(logPackage, "CachedSearchAttachmentsContentCollector.search", err, "vk api error. source=%s", source)
+			collector.sourcesHealth.ReportFailure(source)
+			continue
+		}
+		collector.sourcesHealth.ReportSuccess(source)
+		answeredSources++
+
+		for _, attachmentType := range collector.attachmentTypes {
+			attachments := pickUpWallPostsAttachments(response.Items, attachmentType, &contentCommand.ContentDescriptor, collector.maxContentFetchBound)
+			collector.cachedAttachments[attachmentType] = append(collector.cachedAttachments[attachmentType], attachments...)
+			collector.foundAny = collector.foundAny || len(attachments) != 0
+		}
+	}
+}
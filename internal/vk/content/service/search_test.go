@@ -0,0 +1,123 @@
+package service
+
+import (
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/vk"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// newFakeWallSearchApi returns the same posts for any query and counts wall.search calls
+func newFakeWallSearchApi(posts []object.WallWallpost, searches *int) *api.VK {
+	vkapi := api.NewVK("")
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		*searches++
+		response, _ := json.Marshal(api.WallSearchResponse{Count: len(posts), Items: posts})
+		return api.Response{Response: response}, nil
+	}
+	return vkapi
+}
+
+func newSearchCollector(vkapi *api.VK, expiration time.Duration) *CachedSearchAttachmentsContentCollector {
+	commands := &fakeCommandsRepository{command: model.Command{
+		ID: 1,
+		ContentDescriptor: model.ContentDescriptor{
+			ContentSources: []model.ContentSource{{Kind: model.WallSource, Domain: "jazzjazz", Weight: 1}},
+		},
+	}}
+	return NewCachedSearchAttachmentsContentCollector(
+		vkapi,
+		[]vk.MediaAttachmentType{vk.PhotoType},
+		1,
+		commands,
+		"jazz",
+		expiration,
+		NewContentSourceHealthTracker(3, time.Hour),
+	)
+}
+
+func TestSearchCollectorServesFoundContentFromCache(t *testing.T) {
+	now := time.Now()
+	posts := []object.WallWallpost{newPhotoWallPost(3, now), newPhotoWallPost(2, now), newPhotoWallPost(1, now)}
+	searches := 0
+	collector := newSearchCollector(newFakeWallSearchApi(posts, &searches), time.Hour)
+
+	// every found attachment is delivered once before the next search
+	var actual []int
+	for index := 0; index < len(posts); index++ {
+		if attachment := collector.CollectOne(); attachment != nil {
+			actual = append(actual, attachment.Data.Photo.ID)
+		}
+	}
+	sort.Ints(actual)
+
+	expected := []int{1, 2, 3}
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] || actual[2] != expected[2] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+	if searches != 1 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", searches, 1)
+	}
+
+	// the cache is filled again once it's exhausted
+	if attachment := collector.CollectOne(); attachment == nil || searches != 2 {
+		t.Errorf("Incorrect result. Actual: %v searches, Expected: %v searches and an attachment", searches, 2)
+	}
+}
+
+func TestSearchCollectorCachesEmptyResult(t *testing.T) {
+	searches := 0
+	collector := newSearchCollector(newFakeWallSearchApi(nil, &searches), time.Hour)
+
+	for index := 0; index < 3; index++ {
+		if attachment := collector.CollectOne(); attachment != nil {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", attachment, nil)
+		}
+	}
+
+	// a query without results isn't searched again until the collector expires
+	if searches != 1 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", searches, 1)
+	}
+}
+
+func TestSearchCollectorExpiration(t *testing.T) {
+	searches := 0
+	if newSearchCollector(newFakeWallSearchApi(nil, &searches), time.Hour).IsExpired() {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", true, false)
+	}
+	if !newSearchCollector(newFakeWallSearchApi(nil, &searches), -time.Second).IsExpired() {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", false, true)
+	}
+}
+
+func TestSearchCollectorSearchesAgainAfterFailure(t *testing.T) {
+	posts := []object.WallWallpost{newPhotoWallPost(1, time.Now())}
+	searches := 0
+	vkapi := newFakeWallSearchApi(posts, &searches)
+	answer := vkapi.Handler
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		// the first search fails as if vk is unavailable
+		if searches == 0 {
+			searches++
+			return api.Response{}, errors.New("connection reset by peer")
+		}
+		return answer(method, params...)
+	}
+	collector := newSearchCollector(vkapi, time.Hour)
+
+	if attachment := collector.CollectOne(); attachment != nil || !collector.IsSearchFailed() {
+		t.Errorf("Incorrect result. Actual: %v %v, Expected: %v %v", attachment, collector.IsSearchFailed(), nil, true)
+	}
+
+	attachment := collector.CollectOne()
+	if attachment == nil || attachment.Data.Photo.ID != 1 || collector.IsSearchFailed() || searches != 2 {
+		t.Errorf("Incorrect result. Actual: %v %v searches, Expected: an attachment and %v searches", attachment, searches, 2)
+	}
+}
@@ -33,6 +33,13 @@ func getMaxCachedAttachments(mediaType vk.MediaAttachmentType) int {
 		}
 
 		return int(videoMaxCachedAttachments)
+	case vk.DocumentType:
+		documentMaxCachedAttachments, err := strconv.ParseInt(utils.GetEnvOrDefault(configs.ContentDocumentMaxCachedAttachments), 10, 32)
+		if err != nil {
+			logging.Log.Panic(logPackage, "getMaxCachedAttachments", err, "%s: parsing of env variable is failed", configs.ContentDocumentMaxCachedAttachments.Key)
+		}
+
+		return int(documentMaxCachedAttachments)
 	}
 
 	return 0
@@ -61,6 +68,13 @@ func getCacheRefreshThresholdFor(mediaType vk.MediaAttachmentType) float32 {
 		}
 
 		return float32(videoCacheRefreshThreshold)
+	case vk.DocumentType:
+		documentCacheRefreshThreshold, err := strconv.ParseFloat(utils.GetEnvOrDefault(configs.ContentDocumentCacheRefreshThreshold), 32)
+		if err != nil {
+			logging.Log.Panic(logPackage, "getCacheRefreshThresholdFor", err, "%s: parsing of env variable is failed", configs.ContentDocumentCacheRefreshThreshold.Key)
+		}
+
+		return float32(documentCacheRefreshThreshold)
 	}
 
 	return 0
@@ -0,0 +1,88 @@
+package vk
+
+import (
+	"chattweiler/internal/logging"
+	"chattweiler/internal/repository"
+	"chattweiler/internal/repository/model"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// dryRunWarningsRepository keeps warnings in memory, so the warden goes through
+// its full cycle (warnings, reminders, kicks) without writing anything to a storage.
+// Relevant warnings of a storage are taken once as a starting point
+type dryRunWarningsRepository struct {
+	mutex    sync.Mutex
+	warnings []model.MembershipWarning
+}
+
+func newDryRunWarningsRepository(seed repository.MembershipWarningRepository) *dryRunWarningsRepository {
+	return &dryRunWarningsRepository{
+		warnings: seed.FindAllRelevant(),
+	}
+}
+
+func (repo *dryRunWarningsRepository) Insert(warnings ...model.MembershipWarning) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.warnings = append(repo.warnings, warnings...)
+	logging.Log.Info(logPackage, "dryRunWarningsRepository.Insert", "dry run: users would be warned: %s", describeWarnedUsers(warnings))
+	return true
+}
+
+func (repo *dryRunWarningsRepository) UpdateAllToIrrelevant(warnings ...model.MembershipWarning) bool {
+	return repo.updateAll(warnings, func(stored *model.MembershipWarning, _ model.MembershipWarning) {
+		stored.IsRelevant = false
+	})
+}
+
+func (repo *dryRunWarningsRepository) UpdateRemindersSent(warnings ...model.MembershipWarning) bool {
+	logging.Log.Info(logPackage, "dryRunWarningsRepository.UpdateRemindersSent", "dry run: users would be reminded: %s", describeWarnedUsers(warnings))
+	return repo.updateAll(warnings, func(stored *model.MembershipWarning, warning model.MembershipWarning) {
+		stored.RemindersSent = warning.RemindersSent
+	})
+}
+
+func (repo *dryRunWarningsRepository) updateAll(
+	warnings []model.MembershipWarning,
+	update func(stored *model.MembershipWarning, warning model.MembershipWarning),
+) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	warningsToUpdate := make(map[int]model.MembershipWarning, len(warnings))
+	for _, warning := range warnings {
+		warningsToUpdate[warning.UserID] = warning
+	}
+
+	for index, warning := range repo.warnings {
+		if warningToUpdate, ok := warningsToUpdate[warning.UserID]; ok && warning.IsRelevant {
+			update(&repo.warnings[index], warningToUpdate)
+		}
+	}
+
+	return true
+}
+
+func (repo *dryRunWarningsRepository) FindAllRelevant() []model.MembershipWarning {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	var relevantWarnings []model.MembershipWarning
+	for _, warning := range repo.warnings {
+		if warning.IsRelevant {
+			relevantWarnings = append(relevantWarnings, warning)
+		}
+	}
+	return relevantWarnings
+}
+
+func describeWarnedUsers(warnings []model.MembershipWarning) string {
+	users := make([]string, len(warnings))
+	for index, warning := range warnings {
+		users[index] = fmt.Sprintf("@%s (%d)", warning.Username, warning.UserID)
+	}
+	return strings.Join(users, ", ")
+}
@@ -0,0 +1,66 @@
+package vk
+
+import (
+	"chattweiler/internal/localization"
+	"chattweiler/internal/roulette"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+func TestDryRunGoesThroughWarningReminderAndKick(t *testing.T) {
+	vkapi, fake := newFakeMembershipApi(map[int]bool{10: false})
+	outbox, _ := NewOutbox(vkapi, 0, 1, time.Millisecond, "", "")
+	seed := &fakeWarningsRepository{}
+	checker := NewChecker(
+		1,
+		[]int64{1},
+		AllCommunitiesRule,
+		time.Hour,
+		time.Hour,
+		vkapi,
+		outbox,
+		NewUserProfileCache(vkapi, time.Hour, 0),
+		localization.NewChatLocales("en", nil, time.UTC),
+		roulette.SpinSelector{},
+		&fakePhraseRepository{},
+		seed,
+		nil,
+		nil,
+		false,
+		[]float64{0.5},
+		0,
+		true,
+	)
+	warnings := checker.membershipWarningsRepo.(*dryRunWarningsRepository)
+	members := map[int]object.UsersUser{10: {ID: 10, ScreenName: "john"}}
+
+	// a non-member is warned
+	alreadyForewarnedUsers, err := checker.checkAlreadyRelevantMembershipWarnings(members)
+	if err == nil {
+		err = checker.checkChatForNewWarning(members, alreadyForewarnedUsers)
+	}
+	if err != nil || len(warnings.FindAllRelevant()) != 1 {
+		t.Errorf("Incorrect result. Actual: %v %v, Expected: %v", err, warnings.FindAllRelevant(), "one relevant warning")
+	}
+
+	// he's reminded once the reminder point is passed
+	warnings.warnings[0].FirstWarningTs = time.Now().Add(-40 * time.Minute)
+	_, err = checker.checkAlreadyRelevantMembershipWarnings(members)
+	if relevantWarnings := warnings.FindAllRelevant(); err != nil || len(relevantWarnings) != 1 || relevantWarnings[0].RemindersSent != 1 {
+		t.Errorf("Incorrect result. Actual: %v %v, Expected: %v", err, relevantWarnings, "one warning with a sent reminder")
+	}
+
+	// he's kicked once the grace period is over, so the warning isn't relevant anymore
+	warnings.warnings[0].FirstWarningTs = time.Now().Add(-2 * time.Hour)
+	_, err = checker.checkAlreadyRelevantMembershipWarnings(members)
+	if err != nil || len(warnings.FindAllRelevant()) != 0 {
+		t.Errorf("Incorrect result. Actual: %v %v, Expected: %v", err, warnings.FindAllRelevant(), "no relevant warnings")
+	}
+
+	// nothing is written to the storage, sent or removed actually
+	if len(seed.warnings) != 0 || fake.isCalled("messages.send") || fake.isCalled("messages.removeChatUser") {
+		t.Errorf("Incorrect result. Actual: %v %v, Expected: %v", seed.warnings, fake.methods, "no changes")
+	}
+}
@@ -0,0 +1,54 @@
+package vk
+
+import (
+	"errors"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// ErrorKind a class of a vk api error which tells how the error has to be handled
+type ErrorKind int
+
+const (
+	// UnknownErrorKind any other error, a call is failed
+	UnknownErrorKind ErrorKind = iota
+	// TransientErrorKind a call could be repeated a bit later (errors 6, 9, 10)
+	TransientErrorKind
+	// RateLimitedErrorKind a daily limit of a method is reached for a token (error 29)
+	RateLimitedErrorKind
+	// AuthErrorKind a token is invalid or expired (error 5)
+	AuthErrorKind
+	// AccessDeniedErrorKind a token doesn't have enough permissions (errors 7, 15, 917)
+	AccessDeniedErrorKind
+	// UserNotInChatErrorKind a user is already not in a chat (error 935)
+	UserNotInChatErrorKind
+)
+
+// ClassifyError classifies a vk api error by its code instead of its message,
+// since messages are changed from time to time
+func ClassifyError(err error) ErrorKind {
+	var vkErr *api.Error
+	if !errors.As(err, &vkErr) {
+		return UnknownErrorKind
+	}
+
+	switch vkErr.Code {
+	case api.ErrTooMany, api.ErrFlood, api.ErrServer:
+		return TransientErrorKind
+	case api.ErrRateLimit:
+		return RateLimitedErrorKind
+	case api.ErrAuth:
+		return AuthErrorKind
+	case api.ErrPermission, api.ErrAccess, api.ErrMessagesChatNotAdmin:
+		return AccessDeniedErrorKind
+	case api.ErrMessagesChatUserNotInChat:
+		return UserNotInChatErrorKind
+	default:
+		return UnknownErrorKind
+	}
+}
+
+// IsTransientError tells whether a call could be repeated a bit later with the same token
+func IsTransientError(err error) bool {
+	return ClassifyError(err) == TransientErrorKind
+}
@@ -0,0 +1,31 @@
+package vk
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected ErrorKind
+	}{
+		{&api.Error{Code: api.ErrTooMany}, TransientErrorKind},
+		{&api.Error{Code: api.ErrServer}, TransientErrorKind},
+		{&api.Error{Code: api.ErrRateLimit}, RateLimitedErrorKind},
+		{&api.Error{Code: api.ErrAuth}, AuthErrorKind},
+		{&api.Error{Code: api.ErrMessagesChatUserNotInChat, Message: "any wording"}, UserNotInChatErrorKind},
+		{fmt.Errorf("wrapped: %w", &api.Error{Code: api.ErrMessagesChatUserNotInChat}), UserNotInChatErrorKind},
+		{errors.New("api: User not found in chat"), UnknownErrorKind},
+	}
+
+	for _, test := range tests {
+		actual := ClassifyError(test.err)
+		if actual != test.expected {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, test.expected)
+		}
+	}
+}
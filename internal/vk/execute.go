@@ -0,0 +1,123 @@
+package vk
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// MaxWallWindows a max number of windows fetched by one execute call,
+// the method allows 25 api calls per execute, and one of them is taken by posts' count
+//
+// https://dev.vk.com/method/execute
+const MaxWallWindows = 24
+
+// WallWindowSize https://dev.vk.com/method/wall.get#count parameters' constraints
+const WallWindowSize = 100
+
+// randomWallWindowsScript fetches posts' count of a wall and a sequence of windows after a random offset.
+// The offset is a fraction (in thousandths) of posts' count, so the randomness is provided by a caller
+const randomWallWindowsScript = `
+var count = API.wall.get({"domain": Args.domain, "count": 1}).count;
+var windows = parseInt(Args.windows);
+var windowSize = parseInt(Args.window_size);
+var offset = parseInt(count * parseInt(Args.offset_permille) / 1000);
+if (offset + windows * windowSize > count) {
+	offset = count - windows * windowSize;
+}
+if (offset < 0) {
+	offset = 0;
+}
+
+var items = [];
+var index = 0;
+while (index < windows && offset + index * windowSize < count) {
+	items = items + API.wall.get({"domain": Args.domain, "count": windowSize, "offset": offset + index * windowSize}).items;
+	index = index + 1;
+}
+
+return {"count": count, "offset": offset, "items": items};
+`
+
+type WallWindowsResponse struct {
+	Count  int                   `json:"count"`
+	Offset int                   `json:"offset"`
+	Items  []object.WallWallpost `json:"items"`
+}
+
+// GetRandomWallWindows fetches posts' count and several windows of posts
+// after a random offset of a wall in a single api call
+func GetRandomWallWindows(vkapi *api.VK, community string, windows, offsetPermille int) (WallWindowsResponse, error) {
+	var response WallWindowsResponse
+	err := vkapi.ExecuteWithArgs(randomWallWindowsScript, api.Params{
+		"domain":          community,
+		"windows":         windows,
+		"window_size":     WallWindowSize,
+		"offset_permille": offsetPermille,
+	}, &response)
+
+	return response, err
+}
+
+// MaxIsMemberUserIDs https://dev.vk.com/method/groups.isMember#user_ids parameters' constraints
+const MaxIsMemberUserIDs = 500
+
+// maxIsMemberBatches a max number of groups.isMember calls per execute
+const maxIsMemberBatches = 25
+
+// membershipsScript checks membership of users in a community by batches,
+// the batches are separated by semicolon, users of a batch by comma
+const membershipsScript = `
+var batches = Args.user_ids.split(";");
+var memberships = [];
+var index = 0;
+while (index < batches.length) {
+	memberships = memberships + API.groups.isMember({"group_id": Args.group_id, "user_ids": batches[index]});
+	index = index + 1;
+}
+
+return memberships;
+`
+
+// GetCommunityMemberships checks whether users are members of a community,
+// users are checked by batches of groups.isMember calls inside as few execute calls as possible
+func GetCommunityMemberships(vkapi *api.VK, communityID int64, userIDs []int) (map[int]bool, error) {
+	memberships := make(map[int]bool, len(userIDs))
+	var batches []string
+	for start := 0; start < len(userIDs); start += MaxIsMemberUserIDs {
+		end := start + MaxIsMemberUserIDs
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+
+		batch := make([]string, end-start)
+		for index, userID := range userIDs[start:end] {
+			batch[index] = strconv.Itoa(userID)
+		}
+		batches = append(batches, strings.Join(batch, ","))
+	}
+
+	for start := 0; start < len(batches); start += maxIsMemberBatches {
+		end := start + maxIsMemberBatches
+		if end > len(batches) {
+			end = len(batches)
+		}
+
+		var response []object.GroupsMemberStatus
+		err := vkapi.ExecuteWithArgs(membershipsScript, api.Params{
+			"group_id": communityID,
+			"user_ids": strings.Join(batches[start:end], ";"),
+		}, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, membership := range response {
+			memberships[membership.UserID] = bool(membership.Member)
+		}
+	}
+
+	return memberships, nil
+}
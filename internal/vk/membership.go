@@ -1,10 +1,14 @@
 package vk
 
 import (
+	"chattweiler/internal/localization"
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository"
 	"chattweiler/internal/repository/model"
-	"strconv"
+	"chattweiler/internal/roulette"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
@@ -12,92 +16,356 @@ import (
 	"github.com/SevereCloud/vksdk/v2/object"
 )
 
+type MembershipRule string
+
+const (
+	// a user has to be a member of every required community
+	AllCommunitiesRule MembershipRule = "all"
+	// a user has to be a member of at least one required community
+	AnyCommunityRule MembershipRule = "any"
+)
+
 type Checker struct {
 	// https://dev.vk.com/method/messages.getConversationsById
 	// conversationId = 2000000000 + id, id - chat id
 	conversationId         int64
-	communityId            int64
+	requiredCommunities    []int64
+	membershipRule         MembershipRule
 	checkInterval          time.Duration
 	gracePeriod            time.Duration
 	vkapi                  *api.VK
+	outbox                 *Outbox
+	profiles               *UserProfileCache
+	locales                *localization.ChatLocales
+	phraseSelector         roulette.Selector
 	phrasesRepo            repository.PhraseRepository
 	membershipWarningsRepo repository.MembershipWarningRepository
+	exemptionsRepo         repository.MembershipExemptionRepository
+	kickedUsersRepo        repository.KickedUserRepository
+
+	// managers of required communities aren't checked
+	exemptCommunityManagers bool
+
+	// fractions of a grace period after which warned users are reminded (e.g. 0.5 and 0.9)
+	reminderPoints []float64
+
+	// a grace period for a kicked user who rejoined without subscription, zero means he's removed immediately
+	rejoinGracePeriod time.Duration
+
+	// the whole cycle is run, but messages, kicks and warnings are only logged
+	dryRun bool
+
+	// mentions of required communities for messages by their ids
+	communityMentions map[int64]string
+
+	// guards mentions and writes of warnings, since rejoined users are checked
+	// on the long-poll goroutine at the same time as the check cycle runs
+	mutex sync.Mutex
 }
 
 func NewChecker(
-	conversationId,
-	communityId int64,
+	conversationId int64,
+	requiredCommunities []int64,
+	membershipRule MembershipRule,
 	checkInterval,
 	gracePeriod time.Duration,
 	vkapi *api.VK,
+	outbox *Outbox,
+	profiles *UserProfileCache,
+	locales *localization.ChatLocales,
+	phraseSelector roulette.Selector,
 	phrasesRepo repository.PhraseRepository,
 	membershipWarningsRepo repository.MembershipWarningRepository,
+	exemptionsRepo repository.MembershipExemptionRepository,
+	kickedUsersRepo repository.KickedUserRepository,
+	exemptCommunityManagers bool,
+	reminderPoints []float64,
+	rejoinGracePeriod time.Duration,
+	dryRun bool,
 ) *Checker {
+	if dryRun && membershipWarningsRepo != nil {
+		logging.Log.Warn(logPackage, "NewChecker", "membership checking runs in dry-run mode, nobody will be warned or kicked actually")
+		membershipWarningsRepo = newDryRunWarningsRepository(membershipWarningsRepo)
+	}
+
 	return &Checker{
-		conversationId:         conversationId,
-		communityId:            communityId,
-		checkInterval:          checkInterval,
-		gracePeriod:            gracePeriod,
-		vkapi:                  vkapi,
-		phrasesRepo:            phrasesRepo,
-		membershipWarningsRepo: membershipWarningsRepo,
+		conversationId:          conversationId,
+		requiredCommunities:     requiredCommunities,
+		membershipRule:          membershipRule,
+		checkInterval:           checkInterval,
+		gracePeriod:             gracePeriod,
+		vkapi:                   vkapi,
+		outbox:                  outbox,
+		profiles:                profiles,
+		locales:                 locales,
+		phraseSelector:          phraseSelector,
+		phrasesRepo:             phrasesRepo,
+		membershipWarningsRepo:  membershipWarningsRepo,
+		exemptionsRepo:          exemptionsRepo,
+		kickedUsersRepo:         kickedUsersRepo,
+		exemptCommunityManagers: exemptCommunityManagers,
+		reminderPoints:          reminderPoints,
+		rejoinGracePeriod:       rejoinGracePeriod,
+		dryRun:                  dryRun,
+		communityMentions:       make(map[int64]string),
+	}
+}
+
+// getRequiredMemberships checks membership of users in every required community
+func (checker *Checker) getRequiredMemberships(userIds []int) (map[int64]map[int]bool, error) {
+	memberships := make(map[int64]map[int]bool, len(checker.requiredCommunities))
+	for _, communityId := range checker.requiredCommunities {
+		communityMemberships, err := GetCommunityMemberships(checker.vkapi, communityId, userIds)
+		if err != nil {
+			return nil, err
+		}
+		memberships[communityId] = communityMemberships
+	}
+
+	return memberships, nil
+}
+
+// findMissingCommunities finds required communities which a user isn't a member of, if the membership rule isn't satisfied.
+// A user is considered as checked only if his membership is known for every required community
+func findMissingCommunities(
+	userId int,
+	memberships map[int64]map[int]bool,
+	requiredCommunities []int64,
+	rule MembershipRule,
+) (missingCommunities []int64, isChecked bool) {
+	for _, communityId := range requiredCommunities {
+		isMember, isCheckedInCommunity := memberships[communityId][userId]
+		if !isCheckedInCommunity {
+			return nil, false
+		}
+
+		if !isMember {
+			missingCommunities = append(missingCommunities, communityId)
+		}
+	}
+
+	if rule == AnyCommunityRule && len(missingCommunities) < len(requiredCommunities) {
+		return nil, true
+	}
+
+	return missingCommunities, true
+}
+
+// getMissingCommunitiesMention builds mentions of communities for %missing_communities% placeholder
+func (checker *Checker) getMissingCommunitiesMention(missingCommunities []int64) string {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	var unknownCommunities []int64
+	for _, communityId := range missingCommunities {
+		if _, exists := checker.communityMentions[communityId]; !exists {
+			unknownCommunities = append(unknownCommunities, communityId)
+		}
+	}
+
+	if len(unknownCommunities) != 0 {
+		communities, err := GetCommunities(checker.vkapi, unknownCommunities)
+		if err != nil {
+			logging.Log.Error(logPackage, "Checker.getMissingCommunitiesMention", err, "vk api error")
+		}
+
+		for _, community := range communities {
+			checker.communityMentions[int64(community.ID)] = fmt.Sprintf("@%s (%s)", community.ScreenName, community.Name)
+		}
+	}
+
+	mentions := make([]string, len(missingCommunities))
+	for index, communityId := range missingCommunities {
+		mention, exists := checker.communityMentions[communityId]
+		if !exists {
+			mention = fmt.Sprintf("@club%d", communityId)
+		}
+		mentions[index] = mention
 	}
+
+	separator := ", "
+	if checker.membershipRule == AnyCommunityRule {
+		separator = localization.Text(localization.AlternativesSeparatorText, checker.locales.GetTextLocales(checker.getPeerId())...)
+	}
+
+	return strings.Join(mentions, separator)
+}
+
+func (checker *Checker) getLocale() string {
+	return checker.locales.GetChatLocale(checker.getPeerId())
+}
+
+func (checker *Checker) getPeerId() int {
+	return 2000000000 + int(checker.conversationId)
 }
 
 func (checker *Checker) checkAlreadyRelevantMembershipWarnings(members map[int]object.UsersUser) (map[int]bool, error) {
 	alreadyForewarnedUsers := map[int]bool{}
 	relevantWarnings := checker.membershipWarningsRepo.FindAllRelevant()
 
+	now := time.Now()
 	var expiredWarnings []model.MembershipWarning
+	var reminderCandidates []model.MembershipWarning
+	var usersWithWarning []int
 	for _, warning := range relevantWarnings {
 		gracePeriod, _ := time.ParseDuration(warning.GracePeriod)
-		if time.Now().After(warning.FirstWarningTs.Add(gracePeriod)) {
+		if now.After(warning.FirstWarningTs.Add(gracePeriod)) {
 			expiredWarnings = append(expiredWarnings, warning)
+			usersWithWarning = append(usersWithWarning, warning.UserID)
+		} else if reachedReminders := countReachedReminders(checker.reminderPoints, warning.FirstWarningTs, gracePeriod, now); reachedReminders > warning.RemindersSent {
+			warning.RemindersSent = reachedReminders
+			reminderCandidates = append(reminderCandidates, warning)
+			usersWithWarning = append(usersWithWarning, warning.UserID)
 		}
 		alreadyForewarnedUsers[warning.UserID] = true
 	}
 
-	var membershipVector api.GroupsIsMemberUserIDsResponse
-	if len(expiredWarnings) > 0 {
-		usersWithWarning := make([]int, len(expiredWarnings))
-		isMemberUserIDsBuilder := params.NewGroupsIsMemberBuilder()
-		isMemberUserIDsBuilder.GroupID(strconv.FormatInt(checker.communityId, 10))
-		for _, userWithWarning := range expiredWarnings {
-			usersWithWarning = append(usersWithWarning, userWithWarning.UserID)
-		}
-		isMemberUserIDsBuilder.UserIDs(usersWithWarning)
-		membershipVectorResponse, err := checker.vkapi.GroupsIsMemberUserIDs(isMemberUserIDsBuilder.Params)
-		membershipVector = membershipVectorResponse
-		if err != nil {
-			return nil, err
-		}
+	if len(usersWithWarning) == 0 {
+		return alreadyForewarnedUsers, nil
 	}
 
-	for index, expiredWarning := range expiredWarnings {
-		if membershipVector != nil {
-			_, stillSittingInChat := members[membershipVector[index].UserID]
-			if stillSittingInChat && !bool(membershipVector[index].Member) {
-				messagesRemoveChatUserBuilder := params.NewMessagesRemoveChatUserBuilder()
-				messagesRemoveChatUserBuilder.UserID(expiredWarning.UserID)
-				messagesRemoveChatUserBuilder.ChatID(int(checker.conversationId))
-				_, err := checker.vkapi.MessagesRemoveChatUser(messagesRemoveChatUserBuilder.Params)
-				if err != nil && err.Error() != "api: User not found in chat" {
+	memberships, err := checker.getRequiredMemberships(usersWithWarning)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reminderCandidates) > 0 {
+		checker.remindWarnedUsers(members, reminderCandidates, memberships)
+	}
+
+	if len(expiredWarnings) > 0 {
+		var kickedUsers []object.UsersUser
+		var missingCommunities []int64
+		alreadyMissingCommunities := make(map[int64]bool)
+		for _, expiredWarning := range expiredWarnings {
+			_, stillSittingInChat := members[expiredWarning.UserID]
+			userMissingCommunities, isChecked := findMissingCommunities(expiredWarning.UserID, memberships, checker.requiredCommunities, checker.membershipRule)
+			if stillSittingInChat && isChecked && len(userMissingCommunities) != 0 {
+				err := checker.removeChatUser(expiredWarning.UserID, expiredWarning.Username)
+				if err != nil && ClassifyError(err) != UserNotInChatErrorKind {
 					return nil, err
 				}
+
+				if err == nil {
+					kickedUsers = append(kickedUsers, members[expiredWarning.UserID])
+					missingCommunities = appendMissingCommunities(missingCommunities, alreadyMissingCommunities, userMissingCommunities)
+				}
 			}
 		}
-	}
 
-	if len(expiredWarnings) > 0 {
+		checker.mutex.Lock()
 		checker.membershipWarningsRepo.UpdateAllToIrrelevant(expiredWarnings...)
+		checker.mutex.Unlock()
+		checker.rememberKickedUsers(kickedUsers)
+
+		if len(kickedUsers) > 0 {
+			phrases := checker.phrasesRepo.FindAllByType(model.MembershipKickType, checker.getLocale())
+			if len(phrases) == 0 {
+				logging.Log.Warn(logPackage, "Checker.checkAlreadyRelevantMembershipWarnings", "there's no membership kick phrases, message won't be sent")
+			} else {
+				_ = checker.sendMessageToUsers("Checker.checkAlreadyRelevantMembershipWarnings", phrases, kickedUsers, missingCommunities)
+			}
+		}
 	}
 
 	return alreadyForewarnedUsers, nil
 }
 
+// remindWarnedUsers reminds users who are still not members about their warnings,
+// sent reminders are saved once the message is enqueued, since the outbox delivers it on its own
+func (checker *Checker) remindWarnedUsers(
+	members map[int]object.UsersUser,
+	reminderCandidates []model.MembershipWarning,
+	memberships map[int64]map[int]bool,
+) {
+	var remindedWarnings []model.MembershipWarning
+	var remindedUsers []object.UsersUser
+	var missingCommunities []int64
+	alreadyMissingCommunities := make(map[int64]bool)
+	for _, warning := range reminderCandidates {
+		userProfile, stillSittingInChat := members[warning.UserID]
+		userMissingCommunities, isChecked := findMissingCommunities(warning.UserID, memberships, checker.requiredCommunities, checker.membershipRule)
+		if stillSittingInChat && isChecked && len(userMissingCommunities) != 0 {
+			remindedWarnings = append(remindedWarnings, warning)
+			remindedUsers = append(remindedUsers, userProfile)
+			missingCommunities = appendMissingCommunities(missingCommunities, alreadyMissingCommunities, userMissingCommunities)
+		}
+	}
+
+	if len(remindedUsers) == 0 {
+		return
+	}
+
+	phrases := checker.phrasesRepo.FindAllByType(model.MembershipReminderType, checker.getLocale())
+	if len(phrases) == 0 {
+		logging.Log.Warn(logPackage, "Checker.remindWarnedUsers", "there's no membership reminder phrases, message won't be sent")
+		return
+	}
+
+	err := checker.sendMessageToUsers("Checker.remindWarnedUsers", phrases, remindedUsers, missingCommunities)
+	if err == nil {
+		checker.mutex.Lock()
+		checker.membershipWarningsRepo.UpdateRemindersSent(remindedWarnings...)
+		checker.mutex.Unlock()
+	}
+}
+
+// countReachedReminders counts reminder points (fractions of a grace period) which are already passed
+func countReachedReminders(reminderPoints []float64, firstWarningTs time.Time, gracePeriod time.Duration, now time.Time) int {
+	passedFraction := float64(now.Sub(firstWarningTs)) / float64(gracePeriod)
+	reachedReminders := 0
+	for _, point := range reminderPoints {
+		if passedFraction >= point {
+			reachedReminders++
+		}
+	}
+
+	return reachedReminders
+}
+
+func appendMissingCommunities(missingCommunities []int64, alreadyMissingCommunities map[int64]bool, userMissingCommunities []int64) []int64 {
+	for _, communityId := range userMissingCommunities {
+		if !alreadyMissingCommunities[communityId] {
+			alreadyMissingCommunities[communityId] = true
+			missingCommunities = append(missingCommunities, communityId)
+		}
+	}
+
+	return missingCommunities
+}
+
+func (checker *Checker) sendMessageToUsers(funcName string, phrases []model.Phrase, users []object.UsersUser, missingCommunities []int64) error {
+	peerId := checker.getPeerId()
+	data := NewPhraseData(checker.vkapi, checker.locales, peerId)
+	data.MissingCommunities = checker.getMissingCommunitiesMention(missingCommunities)
+	messageToSend := BuildMessageUsingPersonalizedPhraseForUsers(checker.phraseSelector, peerId, users, phrases, data)
+	if checker.dryRun {
+		logging.Log.Info(logPackage, funcName, "dry run: message would be sent: %s", messageToSend["message"])
+		return nil
+	}
+
+	err := checker.outbox.Enqueue(messageToSend)
+	if err != nil {
+		logging.Log.Error(logPackage, funcName, err, "message enqueuing error. Params: %v", messageToSend)
+	}
+
+	return err
+}
+
+func (checker *Checker) removeChatUser(userId int, username string) error {
+	if checker.dryRun {
+		logging.Log.Info(logPackage, "Checker.removeChatUser", "dry run: user would be removed from chat: @%s (%d)", username, userId)
+		return nil
+	}
+
+	messagesRemoveChatUserBuilder := params.NewMessagesRemoveChatUserBuilder()
+	messagesRemoveChatUserBuilder.UserID(userId)
+	messagesRemoveChatUserBuilder.ChatID(int(checker.conversationId))
+	_, err := checker.vkapi.MessagesRemoveChatUser(messagesRemoveChatUserBuilder.Params)
+	return err
+}
+
 func (checker *Checker) checkChatForNewWarning(members map[int]object.UsersUser, alreadyForewarnedUsers map[int]bool) error {
-	isMemberUserIDsBuilder := params.NewGroupsIsMemberBuilder()
-	isMemberUserIDsBuilder.GroupID(strconv.FormatInt(checker.communityId, 10))
 	userIds := make([]int, len(members))
 	index := 0
 	for userId := range members {
@@ -108,16 +376,25 @@ func (checker *Checker) checkChatForNewWarning(members map[int]object.UsersUser,
 		return nil
 	}
 
-	isMemberUserIDsBuilder.UserIDs(userIds)
-	membershipVector, err := checker.vkapi.GroupsIsMemberUserIDs(isMemberUserIDsBuilder.Params)
+	memberships, err := checker.getRequiredMemberships(userIds)
 	if err != nil {
 		return err
 	}
 
-	for _, membership := range membershipVector {
-		_, alreadyForewarnedUser := alreadyForewarnedUsers[membership.UserID]
-		if !bool(membership.Member) && !alreadyForewarnedUser {
-			userProfile := members[membership.UserID]
+	checker.clearKickRecords(userIds, memberships)
+
+	// all non-members are warned at once, so newcomers don't wait for their turn
+	var newWarnings []model.MembershipWarning
+	var warnedUsers []object.UsersUser
+	var missingCommunities []int64
+	alreadyMissingCommunities := make(map[int64]bool)
+	for _, userId := range userIds {
+		_, alreadyForewarnedUser := alreadyForewarnedUsers[userId]
+		userMissingCommunities, isChecked := findMissingCommunities(userId, memberships, checker.requiredCommunities, checker.membershipRule)
+		if isChecked && len(userMissingCommunities) != 0 && !alreadyForewarnedUser {
+			missingCommunities = appendMissingCommunities(missingCommunities, alreadyMissingCommunities, userMissingCommunities)
+
+			userProfile := members[userId]
 
 			newWarning := model.MembershipWarning{}
 			newWarning.IsRelevant = true
@@ -125,27 +402,141 @@ func (checker *Checker) checkChatForNewWarning(members map[int]object.UsersUser,
 			newWarning.FirstWarningTs = time.Now()
 			newWarning.Username = userProfile.ScreenName
 			newWarning.UserID = userProfile.ID
-			checker.membershipWarningsRepo.Insert(newWarning)
+			newWarnings = append(newWarnings, newWarning)
+			warnedUsers = append(warnedUsers, userProfile)
+		}
+	}
 
-			phrases := checker.phrasesRepo.FindAllByType(model.MembershipWarningType)
-			if len(phrases) == 0 {
-				logging.Log.Warn(logPackage, "Checker.checkChatForNewWarning", "there's no membership warning phrases, message won't be sent")
-				return nil
-			}
+	if len(newWarnings) == 0 {
+		return nil
+	}
 
-			peerId := 2000000000 + int(checker.conversationId)
-			messageToSend := BuildMessageUsingPersonalizedPhrase(peerId, &userProfile, phrases)
-			_, err := checker.vkapi.MessagesSend(messageToSend)
-			if err != nil {
-				logging.Log.Error(logPackage, "Checker.checkChatForNewWarning", err, "message sending error. Sent params: %v", messageToSend)
-				return err
-			}
+	checker.mutex.Lock()
+	checker.membershipWarningsRepo.Insert(newWarnings...)
+	checker.mutex.Unlock()
+
+	var phrases []model.Phrase
+	if len(warnedUsers) > 1 {
+		phrases = checker.phrasesRepo.FindAllByType(model.MembershipWarningPluralType, checker.getLocale())
+	}
+	if len(phrases) == 0 {
+		phrases = checker.phrasesRepo.FindAllByType(model.MembershipWarningType, checker.getLocale())
+	}
+	if len(phrases) == 0 {
+		logging.Log.Warn(logPackage, "Checker.checkChatForNewWarning", "there's no membership warning phrases, message won't be sent")
+		return nil
+	}
+
+	return checker.sendMessageToUsers("Checker.checkChatForNewWarning", phrases, warnedUsers, missingCommunities)
+}
+
+// rememberKickedUsers keeps kicked users, so they don't get a full grace period after rejoining
+func (checker *Checker) rememberKickedUsers(users []object.UsersUser) {
+	if checker.kickedUsersRepo == nil || checker.dryRun || len(users) == 0 {
+		return
+	}
 
-			return nil
+	now := time.Now()
+	kickedUsers := make([]model.KickedUser, len(users))
+	for index, user := range users {
+		kickedUsers[index] = model.KickedUser{
+			UserID:   user.ID,
+			Username: user.ScreenName,
+			KickedTs: now,
 		}
 	}
+	checker.kickedUsersRepo.Insert(kickedUsers...)
+}
+
+// clearKickRecords clears records about kicks of members who are subscribed now,
+// so they aren't treated as rejoined ones after they leave and join again
+func (checker *Checker) clearKickRecords(userIds []int, memberships map[int64]map[int]bool) {
+	if checker.kickedUsersRepo == nil || checker.dryRun {
+		return
+	}
 
-	return nil
+	var subscribedKickedUserIds []int
+	for _, userId := range userIds {
+		missingCommunities, isChecked := findMissingCommunities(userId, memberships, checker.requiredCommunities, checker.membershipRule)
+		if isChecked && len(missingCommunities) == 0 && checker.kickedUsersRepo.FindByUserID(userId) != nil {
+			subscribedKickedUserIds = append(subscribedKickedUserIds, userId)
+		}
+	}
+
+	if len(subscribedKickedUserIds) != 0 {
+		checker.kickedUsersRepo.Delete(subscribedKickedUserIds...)
+	}
+}
+
+// CheckRejoinedUser checks a user who joined the chat, if he was kicked and still isn't subscribed,
+// he's either removed immediately or warned with a shorter grace period.
+// Returns true if the user is removed. The record about a kick is cleared once a user subscribes
+func (checker *Checker) CheckRejoinedUser(peerId int, user *object.UsersUser) bool {
+	if checker.kickedUsersRepo == nil || peerId != checker.getPeerId() {
+		return false
+	}
+
+	if checker.exemptionsRepo != nil && checker.exemptionsRepo.IsExempted(user.ID) {
+		return false
+	}
+
+	if checker.kickedUsersRepo.FindByUserID(user.ID) == nil {
+		return false
+	}
+
+	memberships, err := checker.getRequiredMemberships([]int{user.ID})
+	if err != nil {
+		logging.Log.Error(logPackage, "Checker.CheckRejoinedUser", err, "vk api error")
+		return false
+	}
+
+	missingCommunities, isChecked := findMissingCommunities(user.ID, memberships, checker.requiredCommunities, checker.membershipRule)
+	if !isChecked {
+		return false
+	}
+
+	if len(missingCommunities) == 0 {
+		if !checker.dryRun {
+			checker.kickedUsersRepo.Delete(user.ID)
+		}
+		return false
+	}
+
+	if checker.rejoinGracePeriod > 0 {
+		newWarning := model.MembershipWarning{}
+		newWarning.IsRelevant = true
+		newWarning.GracePeriod = checker.rejoinGracePeriod.String()
+		newWarning.FirstWarningTs = time.Now()
+		newWarning.Username = user.ScreenName
+		newWarning.UserID = user.ID
+		checker.mutex.Lock()
+		checker.membershipWarningsRepo.Insert(newWarning)
+		checker.mutex.Unlock()
+
+		phrases := checker.phrasesRepo.FindAllByType(model.MembershipWarningType, checker.getLocale())
+		if len(phrases) == 0 {
+			logging.Log.Warn(logPackage, "Checker.CheckRejoinedUser", "there's no membership warning phrases, message won't be sent")
+			return false
+		}
+
+		_ = checker.sendMessageToUsers("Checker.CheckRejoinedUser", phrases, []object.UsersUser{*user}, missingCommunities)
+		return false
+	}
+
+	err = checker.removeChatUser(user.ID, user.ScreenName)
+	if err != nil {
+		logging.Log.Error(logPackage, "Checker.CheckRejoinedUser", err, "user removing error")
+		return false
+	}
+
+	phrases := checker.phrasesRepo.FindAllByType(model.MembershipRejoinType, checker.getLocale())
+	if len(phrases) == 0 {
+		logging.Log.Warn(logPackage, "Checker.CheckRejoinedUser", "there's no membership rejoin phrases, message won't be sent")
+		return true
+	}
+
+	_ = checker.sendMessageToUsers("Checker.CheckRejoinedUser", phrases, []object.UsersUser{*user}, missingCommunities)
+	return true
 }
 
 func (checker *Checker) LoopCheck() {
@@ -158,16 +549,16 @@ func (checker *Checker) LoopCheck() {
 			time.Sleep(checker.checkInterval)
 		}
 
-		conversationMembers, err := checker.vkapi.MessagesGetConversationMembers(api.Params{
-			"peer_id": 2000000000 + checker.conversationId,
-		})
+		conversationMembers, err := GetAllConversationMembers(checker.vkapi, 2000000000+checker.conversationId)
 		if err != nil {
 			logging.Log.Error(logPackage, "Checker.LoopCheck", err, "vk api error")
 			successfulCheckAttempt = false
 			continue
 		}
 
+		checker.profiles.Put(conversationMembers.Profiles...)
 		members := filterOnlyCommonMembers(conversationMembers)
+		checker.excludeExemptedMembers(members)
 		alreadyForewarnedUsers, err := checker.checkAlreadyRelevantMembershipWarnings(members)
 		if err != nil {
 			logging.Log.Error(logPackage, "Checker.LoopCheck", err, "error occurred during relevant membership warnings fetching")
@@ -187,6 +578,35 @@ func (checker *Checker) LoopCheck() {
 	}
 }
 
+// excludeExemptedMembers removes exempted users and managers of required communities from members,
+// so they're never warned or kicked
+func (checker *Checker) excludeExemptedMembers(members map[int]object.UsersUser) {
+	if checker.exemptionsRepo != nil {
+		for userId := range members {
+			if checker.exemptionsRepo.IsExempted(userId) {
+				delete(members, userId)
+			}
+		}
+	}
+
+	if checker.exemptCommunityManagers {
+		for _, communityId := range checker.requiredCommunities {
+			// managers are available only for community admins, so such communities are skipped
+			managers, err := checker.vkapi.GroupsGetMembersFilterManagers(api.Params{
+				"group_id": communityId,
+			})
+			if err != nil {
+				logging.Log.Warn(logPackage, "Checker.excludeExemptedMembers", "managers of community %d aren't available: %s", communityId, err)
+				continue
+			}
+
+			for _, manager := range managers.Items {
+				delete(members, manager.ID)
+			}
+		}
+	}
+}
+
 func filterOnlyCommonMembers(response api.MessagesGetConversationMembersResponse) map[int]object.UsersUser {
 	commonMembers := make(map[int]bool)
 	for _, member := range response.Items {
@@ -0,0 +1,295 @@
+package vk
+
+import (
+	"chattweiler/internal/localization"
+	"chattweiler/internal/repository/model"
+	"chattweiler/internal/roulette"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+func TestFindMissingCommunities(t *testing.T) {
+	memberships := map[int64]map[int]bool{
+		1: {10: true, 20: false, 30: false},
+		2: {10: true, 20: true, 30: false},
+	}
+	requiredCommunities := []int64{1, 2}
+
+	tests := []struct {
+		userId          int
+		rule            MembershipRule
+		expectedMissing []int64
+		expectedChecked bool
+	}{
+		{10, AllCommunitiesRule, nil, true},
+		{20, AllCommunitiesRule, []int64{1}, true},
+		{20, AnyCommunityRule, nil, true},
+		{30, AnyCommunityRule, []int64{1, 2}, true},
+		{40, AllCommunitiesRule, nil, false},
+	}
+
+	for _, test := range tests {
+		actualMissing, actualChecked := findMissingCommunities(test.userId, memberships, requiredCommunities, test.rule)
+		if !reflect.DeepEqual(actualMissing, test.expectedMissing) || actualChecked != test.expectedChecked {
+			t.Errorf("Incorrect result. Actual: %v %v, Expected: %v %v", actualMissing, actualChecked, test.expectedMissing, test.expectedChecked)
+		}
+	}
+}
+
+func TestCountReachedReminders(t *testing.T) {
+	firstWarningTs := time.Now()
+	reminderPoints := []float64{0.5, 0.9}
+
+	tests := []struct {
+		passed   time.Duration
+		expected int
+	}{
+		{10 * time.Minute, 0},
+		{30 * time.Minute, 1},
+		{55 * time.Minute, 2},
+	}
+
+	for _, test := range tests {
+		actual := countReachedReminders(reminderPoints, firstWarningTs, time.Hour, firstWarningTs.Add(test.passed))
+		if actual != test.expected {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, test.expected)
+		}
+	}
+}
+
+type fakeKickedUsersRepository struct {
+	mutex       sync.Mutex
+	kickedUsers map[int]model.KickedUser
+}
+
+func (repo *fakeKickedUsersRepository) Insert(kickedUsers ...model.KickedUser) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, kickedUser := range kickedUsers {
+		repo.kickedUsers[kickedUser.UserID] = kickedUser
+	}
+	return true
+}
+
+func (repo *fakeKickedUsersRepository) FindByUserID(userID int) *model.KickedUser {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	kickedUser, exists := repo.kickedUsers[userID]
+	if !exists {
+		return nil
+	}
+	return &kickedUser
+}
+
+func (repo *fakeKickedUsersRepository) Delete(userIDs ...int) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, userID := range userIDs {
+		delete(repo.kickedUsers, userID)
+	}
+	return true
+}
+
+type fakeWarningsRepository struct {
+	mutex    sync.Mutex
+	warnings []model.MembershipWarning
+}
+
+func (repo *fakeWarningsRepository) Insert(warnings ...model.MembershipWarning) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.warnings = append(repo.warnings, warnings...)
+	return true
+}
+
+func (repo *fakeWarningsRepository) UpdateAllToIrrelevant(...model.MembershipWarning) bool {
+	return true
+}
+
+func (repo *fakeWarningsRepository) UpdateRemindersSent(...model.MembershipWarning) bool {
+	return true
+}
+
+func (repo *fakeWarningsRepository) FindAllRelevant() []model.MembershipWarning {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	return append([]model.MembershipWarning(nil), repo.warnings...)
+}
+
+type fakePhraseRepository struct{}
+
+func (repo *fakePhraseRepository) FindAll() []model.Phrase {
+	return nil
+}
+
+func (repo *fakePhraseRepository) FindAllByType(phraseType model.PhraseType, _ string) []model.Phrase {
+	return []model.Phrase{{PhraseID: 1, Weight: 1, PhraseType: phraseType, Text: string(phraseType)}}
+}
+
+// fakeMembershipApi answers that users are members of the community if they're subscribed, and records called methods
+type fakeMembershipApi struct {
+	mutex      sync.Mutex
+	subscribed map[int]bool
+	methods    []string
+}
+
+func newFakeMembershipApi(subscribed map[int]bool) (*api.VK, *fakeMembershipApi) {
+	fake := &fakeMembershipApi{subscribed: subscribed}
+	vkapi := api.NewVK("")
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+
+		fake.methods = append(fake.methods, method)
+		switch method {
+		case "execute":
+			var memberships []string
+			for userId, isSubscribed := range fake.subscribed {
+				member := 0
+				if isSubscribed {
+					member = 1
+				}
+				memberships = append(memberships, fmt.Sprintf(`{"member": %d, "user_id": %d}`, member, userId))
+			}
+			return api.Response{Response: []byte("[" + strings.Join(memberships, ",") + "]")}, nil
+		case "groups.getById":
+			return api.Response{Response: []byte(`[{"id": 1, "screen_name": "jazzjazz", "name": "Jazz"}]`)}, nil
+		default:
+			return api.Response{Response: []byte("1")}, nil
+		}
+	}
+	return vkapi, fake
+}
+
+func (fake *fakeMembershipApi) isCalled(method string) bool {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	for _, calledMethod := range fake.methods {
+		if calledMethod == method {
+			return true
+		}
+	}
+	return false
+}
+
+func newRejoinChecker(vkapi *api.VK, kickedUsers *fakeKickedUsersRepository, warnings *fakeWarningsRepository, rejoinGracePeriod time.Duration) *Checker {
+	outbox, _ := NewOutbox(vkapi, 0, 1, time.Millisecond, "", "")
+	return NewChecker(
+		1,
+		[]int64{1},
+		AllCommunitiesRule,
+		time.Hour,
+		time.Hour,
+		vkapi,
+		outbox,
+		NewUserProfileCache(vkapi, time.Hour, 0),
+		localization.NewChatLocales("en", nil, time.UTC),
+		roulette.SpinSelector{},
+		&fakePhraseRepository{},
+		warnings,
+		nil,
+		kickedUsers,
+		false,
+		nil,
+		rejoinGracePeriod,
+		false,
+	)
+}
+
+func TestCheckRejoinedUser(t *testing.T) {
+	user := &object.UsersUser{ID: 10, ScreenName: "john"}
+	kickedUser := model.KickedUser{UserID: 10, Username: "john", KickedTs: time.Now()}
+
+	tests := []struct {
+		name              string
+		isKicked          bool
+		isSubscribed      bool
+		rejoinGracePeriod time.Duration
+		expectedRemoved   bool
+		expectedKicked    bool
+		expectedWarnings  int
+	}{
+		{"not kicked user", false, false, 0, false, false, 0},
+		{"kicked user who subscribed", true, true, 0, false, false, 0},
+		{"kicked user without subscription", true, false, 0, true, true, 0},
+		{"kicked user with rejoin grace period", true, false, time.Hour, false, true, 1},
+	}
+
+	for _, test := range tests {
+		vkapi, fake := newFakeMembershipApi(map[int]bool{user.ID: test.isSubscribed})
+		kickedUsers := &fakeKickedUsersRepository{kickedUsers: make(map[int]model.KickedUser)}
+		if test.isKicked {
+			kickedUsers.Insert(kickedUser)
+		}
+		warnings := &fakeWarningsRepository{}
+		checker := newRejoinChecker(vkapi, kickedUsers, warnings, test.rejoinGracePeriod)
+
+		actualRemoved := checker.CheckRejoinedUser(2000000001, user)
+		actualKicked := kickedUsers.FindByUserID(user.ID) != nil
+		if actualRemoved != test.expectedRemoved || actualKicked != test.expectedKicked || len(warnings.warnings) != test.expectedWarnings {
+			t.Errorf("Incorrect result for %s. Actual: %v %v %v, Expected: %v %v %v", test.name,
+				actualRemoved, actualKicked, len(warnings.warnings), test.expectedRemoved, test.expectedKicked, test.expectedWarnings)
+		}
+
+		if fake.isCalled("messages.removeChatUser") != test.expectedRemoved {
+			t.Errorf("Incorrect result for %s. Actual: %v, Expected: %v", test.name, !test.expectedRemoved, test.expectedRemoved)
+		}
+	}
+}
+
+func TestCheckRejoinedUserIgnoresOtherChats(t *testing.T) {
+	vkapi, fake := newFakeMembershipApi(map[int]bool{10: false})
+	kickedUsers := &fakeKickedUsersRepository{kickedUsers: map[int]model.KickedUser{10: {UserID: 10}}}
+	checker := newRejoinChecker(vkapi, kickedUsers, &fakeWarningsRepository{}, 0)
+
+	if checker.CheckRejoinedUser(2000000002, &object.UsersUser{ID: 10}) || fake.isCalled("execute") {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", true, false)
+	}
+}
+
+func TestClearKickRecordsOfSubscribedMembers(t *testing.T) {
+	vkapi, _ := newFakeMembershipApi(nil)
+	kickedUsers := &fakeKickedUsersRepository{kickedUsers: map[int]model.KickedUser{10: {UserID: 10}, 20: {UserID: 20}}}
+	checker := newRejoinChecker(vkapi, kickedUsers, &fakeWarningsRepository{}, 0)
+
+	checker.clearKickRecords([]int{10, 20, 30}, map[int64]map[int]bool{1: {10: true, 20: false, 30: true}})
+	if kickedUsers.FindByUserID(10) != nil || kickedUsers.FindByUserID(20) == nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", kickedUsers.kickedUsers, "only user 20")
+	}
+}
+
+func TestCheckRejoinedUserAlongsideCheckCycle(t *testing.T) {
+	for attempt := 0; attempt < 20; attempt++ {
+		vkapi, _ := newFakeMembershipApi(map[int]bool{10: false, 20: false})
+		kickedUsers := &fakeKickedUsersRepository{kickedUsers: map[int]model.KickedUser{10: {UserID: 10}}}
+		warnings := &fakeWarningsRepository{}
+		checker := newRejoinChecker(vkapi, kickedUsers, warnings, time.Hour)
+
+		// a kicked user rejoins while the cycle warns another member, both of them are warned
+		var waitGroup sync.WaitGroup
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			checker.CheckRejoinedUser(2000000001, &object.UsersUser{ID: 10, ScreenName: "john"})
+		}()
+		err := checker.checkChatForNewWarning(map[int]object.UsersUser{20: {ID: 20, ScreenName: "anna"}}, map[int]bool{})
+		waitGroup.Wait()
+
+		if actual := len(warnings.FindAllRelevant()); err != nil || actual != 2 {
+			t.Errorf("Incorrect result. Actual: %v %v, Expected: %v", err, actual, 2)
+		}
+	}
+}
@@ -2,62 +2,115 @@ package vk
 
 import (
 	"chattweiler/internal/configs"
+	"chattweiler/internal/localization"
 	"chattweiler/internal/logging"
 	"chattweiler/internal/repository/model"
 	"chattweiler/internal/roulette"
+	"chattweiler/internal/templating"
 	"chattweiler/internal/utils"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
 	"github.com/SevereCloud/vksdk/v2/api/params"
 	"github.com/SevereCloud/vksdk/v2/object"
 )
 
+// BuildDirectedMessage builds an empty message for a peer, random_id of messages is assigned by the Outbox
 func BuildDirectedMessage(peerId int) api.Params {
 	builder := params.NewMessagesSendBuilder()
 	builder.PeerID(peerId)
-	builder.RandomID(rand.Int())
 	return builder.Params
 }
 
 func BuildMessageUsingPersonalizedPhrase(
+	selector roulette.Selector,
 	peerId int,
 	user *object.UsersUser,
 	phrases []model.Phrase,
+	data *templating.Data,
 ) api.Params {
-	phrase := roulette.Spin(phrases...)
+	return BuildMessageUsingPersonalizedPhraseForUsers(selector, peerId, []object.UsersUser{*user}, phrases, data)
+}
+
+// BuildMessageUsingPersonalizedPhraseForUsers builds one message which mentions all the users, a phrase is picked up by the selector.
+// A template phrase is rendered with the data, otherwise the users are put in place
+// of either %usernames% or %username% placeholder and %missing_communities% is replaced by the data's value
+func BuildMessageUsingPersonalizedPhraseForUsers(
+	selector roulette.Selector,
+	peerId int,
+	users []object.UsersUser,
+	phrases []model.Phrase,
+	data *templating.Data,
+) api.Params {
+	phrase := selector.Select(peerId, phrases...)
 	builder := params.NewMessagesSendBuilder()
 	builder.PeerID(peerId)
-	builder.RandomID(rand.Int())
+
+	if data == nil {
+		data = templating.NewData(time.Now(), nil)
+	}
+	data.Users = make([]templating.User, len(users))
+	for index := range users {
+		data.Users[index] = templating.NewUser(users[index])
+	}
+
+	if templating.IsTemplate(phrase.Text) {
+		builder.Message(renderPhrase(phrase, data))
+		appendAttachments(phrase, builder)
+		return builder.Params
+	}
 
 	useFirstNameInsteadUsername, err := strconv.ParseBool(utils.GetEnvOrDefault(configs.ChatUseFirstNameInsteadUsername))
 	if err != nil {
-		logging.Log.Error(logPackage, "BuildMessageUsingPersonalizedPhrase", err, "%s: parsing of env variable is failed", configs.ChatUseFirstNameInsteadUsername.Key)
+		logging.Log.Error(logPackage, "BuildMessageUsingPersonalizedPhraseForUsers", err, "%s: parsing of env variable is failed", configs.ChatUseFirstNameInsteadUsername.Key)
 	}
 
-	if phrase.UserTemplated() {
+	mentions := make([]string, len(users))
+	for index := range users {
 		if useFirstNameInsteadUsername {
-			builder.Message(strings.ReplaceAll(phrase.Text, "%username%", fmt.Sprintf("@%s (%s)", user.ScreenName, user.FirstName)))
+			mentions[index] = fmt.Sprintf("@%s (%s)", users[index].ScreenName, users[index].FirstName)
 		} else {
-			builder.Message(strings.ReplaceAll(phrase.Text, "%username%", "@"+user.ScreenName))
+			mentions[index] = "@" + users[index].ScreenName
 		}
+	}
+
+	text := phrase.Text
+	if len(data.MissingCommunities) != 0 {
+		text = strings.ReplaceAll(text, "%missing_communities%", data.MissingCommunities)
+	}
+
+	if phrase.UsersTemplated() {
+		builder.Message(strings.ReplaceAll(text, "%usernames%", strings.Join(mentions, ", ")))
+	} else if phrase.UserTemplated() {
+		builder.Message(strings.ReplaceAll(text, "%username%", strings.Join(mentions, ", ")))
 	} else {
-		builder.Message(fmt.Sprintf("%s, \n\n%s", "@"+user.ScreenName, phrase.Text))
+		builder.Message(fmt.Sprintf("%s, \n\n%s", localization.JoinList(plainMentions(users), data.Locales...), text))
 	}
 
 	appendAttachments(phrase, builder)
 	return builder.Params
 }
 
-func BuildMessageWithRandomPhrase(peerId int, phrases []model.Phrase) api.Params {
-	phrase := roulette.Spin(phrases...)
+func plainMentions(users []object.UsersUser) []string {
+	mentions := make([]string, len(users))
+	for index := range users {
+		mentions[index] = "@" + users[index].ScreenName
+	}
+	return mentions
+}
+
+func BuildMessageWithRandomPhrase(selector roulette.Selector, peerId int, phrases []model.Phrase, data *templating.Data) api.Params {
+	phrase := selector.Select(peerId, phrases...)
 	builder := params.NewMessagesSendBuilder()
 	builder.PeerID(peerId)
-	builder.RandomID(0)
-	builder.Message(phrase.Text)
+	if templating.IsTemplate(phrase.Text) && data != nil {
+		builder.Message(renderPhrase(phrase, data))
+	} else {
+		builder.Message(phrase.Text)
+	}
 	appendAttachments(phrase, builder)
 	return builder.Params
 }
@@ -77,3 +130,35 @@ func appendAttachments(phrase *model.Phrase, builder *params.MessagesSendBuilder
 		builder.Attachment(strings.Join(attachments, ","))
 	}
 }
+
+// renderPhrase renders a template phrase, templates are validated when phrases are loaded,
+// so a phrase is sent as is only if its rendering is failed unexpectedly
+func renderPhrase(phrase *model.Phrase, data *templating.Data) string {
+	text, err := templating.Render(phrase.Text, data)
+	if err != nil {
+		logging.Log.Error(logPackage, "renderPhrase", err, "phrase %d rendering error", phrase.PhraseID)
+		return phrase.Text
+	}
+	return text
+}
+
+// NewPhraseData creates data for phrases which are sent to a peer in its locale, the chat is fetched only if a phrase uses it
+func NewPhraseData(vkapi *api.VK, locales *localization.ChatLocales, peerId int) *templating.Data {
+	data := templating.NewData(time.Now().In(locales.Location()), func() (templating.Chat, error) {
+		conversations, err := vkapi.MessagesGetConversationsByID(api.Params{
+			"peer_ids": peerId,
+		})
+		if err != nil {
+			return templating.Chat{}, err
+		}
+
+		if len(conversations.Items) == 0 {
+			return templating.Chat{}, fmt.Errorf("conversation %d not found", peerId)
+		}
+
+		chatSettings := conversations.Items[0].ChatSettings
+		return templating.Chat{Name: chatSettings.Title, MemberCount: chatSettings.MembersCount}, nil
+	})
+	data.Locales = locales.GetTextLocales(peerId)
+	return data
+}
@@ -0,0 +1,339 @@
+package vk
+
+import (
+	"chattweiler/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// OutgoingMessage a message waiting for its delivery, params are kept formatted,
+// so a message is the same after it's restored from a disk
+type OutgoingMessage struct {
+	ID         string            `json:"id"`
+	Seq        int64             `json:"seq"`
+	PeerID     int               `json:"peer_id"`
+	Params     map[string]string `json:"params"`
+	EnqueuedAt time.Time         `json:"enqueued_at"`
+
+	// builds a message which is sent instead if this one isn't delivered, it's called only then,
+	// so phrases of an unused fallback aren't picked up. It isn't persisted and is lost after a restart
+	buildFallback func() api.Params
+}
+
+// RandomID a random_id of a message, it's derived from the message id,
+// so vk drops duplicates if a message is sent again after a retry or a restart
+func (message *OutgoingMessage) RandomID() int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(message.ID))
+	return int(hash.Sum32() & 0x7fffffff)
+}
+
+type deadLetter struct {
+	Message  *OutgoingMessage `json:"message"`
+	Error    string           `json:"error"`
+	Attempts int              `json:"attempts"`
+	FailedAt time.Time        `json:"failed_at"`
+}
+
+// Outbox delivers messages asynchronously. Messages of a peer are sent one by one in order of enqueuing
+// with an interval between them, a message failed by a network error is retried with a backoff and goes
+// to the dead letters after the last attempt. Vk errors aren't retried here, transient ones are already
+// retried by the request policy of the client. Pending messages are saved to the persistence file (if it's specified),
+// so they're delivered after a restart
+type Outbox struct {
+	vkapi           *api.VK
+	sendInterval    time.Duration
+	maxAttempts     int
+	baseBackoff     time.Duration
+	maxBackoff      time.Duration
+	persistenceFile string
+	deadLettersFile string
+
+	mutex   sync.Mutex
+	seq     int64
+	queues  map[int][]*OutgoingMessage
+	senders map[int]bool
+}
+
+func NewOutbox(
+	vkapi *api.VK,
+	sendInterval time.Duration,
+	maxAttempts int,
+	baseBackoff time.Duration,
+	persistenceFile string,
+	deadLettersFile string,
+) (*Outbox, error) {
+	// a message is sent at least once
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	outbox := &Outbox{
+		vkapi:           vkapi,
+		sendInterval:    sendInterval,
+		maxAttempts:     maxAttempts,
+		baseBackoff:     baseBackoff,
+		maxBackoff:      10 * baseBackoff,
+		persistenceFile: persistenceFile,
+		deadLettersFile: deadLettersFile,
+		queues:          make(map[int][]*OutgoingMessage),
+		senders:         make(map[int]bool),
+	}
+
+	err := outbox.restore()
+	if err != nil {
+		return nil, err
+	}
+
+	return outbox, nil
+}
+
+// Start starts delivery of messages which are restored from the persistence file
+func (outbox *Outbox) Start() {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	for peerId := range outbox.queues {
+		outbox.startSender(peerId)
+	}
+}
+
+// Enqueue puts a message in a queue of its peer
+func (outbox *Outbox) Enqueue(message api.Params) error {
+	return outbox.EnqueueWithFallback(message, nil)
+}
+
+// EnqueueWithFallback puts a message in a queue of its peer, a fallback message is built
+// and enqueued instead if the message isn't delivered (nil means there's no fallback)
+func (outbox *Outbox) EnqueueWithFallback(message api.Params, buildFallback func() api.Params) error {
+	peerId, err := strconv.Atoi(api.FmtValue(message["peer_id"], 0))
+	if err != nil {
+		return fmt.Errorf("message without peer_id can't be enqueued: %w", err)
+	}
+
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	outbox.seq++
+	enqueuedAt := time.Now()
+	outgoingMessage := &OutgoingMessage{
+		ID:            fmt.Sprintf("%d-%d-%d", peerId, enqueuedAt.UnixNano(), outbox.seq),
+		Seq:           outbox.seq,
+		PeerID:        peerId,
+		Params:        formatParams(message),
+		EnqueuedAt:    enqueuedAt,
+		buildFallback: buildFallback,
+	}
+	outgoingMessage.Params["random_id"] = strconv.Itoa(outgoingMessage.RandomID())
+
+	outbox.queues[peerId] = append(outbox.queues[peerId], outgoingMessage)
+	outbox.persist()
+	outbox.startSender(peerId)
+	return nil
+}
+
+// startSender starts a sender of a peer if it's not running, must be called under the lock
+func (outbox *Outbox) startSender(peerId int) {
+	if outbox.senders[peerId] {
+		return
+	}
+
+	outbox.senders[peerId] = true
+	go outbox.deliverPeerMessages(peerId)
+}
+
+func (outbox *Outbox) deliverPeerMessages(peerId int) {
+	for {
+		message := outbox.peek(peerId)
+		if message == nil {
+			return
+		}
+
+		attempts, err := outbox.send(message)
+		outbox.remove(peerId, message)
+		if err != nil {
+			outbox.writeDeadLetter(message, attempts, err)
+			if message.buildFallback != nil {
+				if fallback := message.buildFallback(); fallback != nil {
+					_ = outbox.Enqueue(fallback)
+				}
+			}
+		}
+
+		time.Sleep(outbox.sendInterval)
+	}
+}
+
+// peek returns the first message of a peer or stops its sender if there's no messages
+func (outbox *Outbox) peek(peerId int) *OutgoingMessage {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	queue := outbox.queues[peerId]
+	if len(queue) == 0 {
+		delete(outbox.queues, peerId)
+		delete(outbox.senders, peerId)
+		return nil
+	}
+
+	return queue[0]
+}
+
+func (outbox *Outbox) remove(peerId int, message *OutgoingMessage) {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	queue := outbox.queues[peerId]
+	if len(queue) != 0 && queue[0] == message {
+		outbox.queues[peerId] = queue[1:]
+	}
+	outbox.persist()
+}
+
+func (outbox *Outbox) send(message *OutgoingMessage) (int, error) {
+	var err error
+	attempt := 0
+	for attempt < outbox.maxAttempts {
+		attempt++
+		_, err = outbox.vkapi.MessagesSend(parseParams(message.Params))
+		if err == nil || isVkSendingError(err) || attempt >= outbox.maxAttempts {
+			break
+		}
+
+		backoff := getJitteredBackoff(outbox.baseBackoff, outbox.maxBackoff, attempt-1)
+		logging.Log.Warn(logPackage, "Outbox.send", "message %s sending is failed, retry in %s: %s", message.ID, backoff, err)
+		time.Sleep(backoff)
+	}
+
+	return attempt, err
+}
+
+// isVkSendingError tells whether vk answered with an error, so its sending isn't repeated:
+// either vk rejected a message itself (e.g. it's too long or the chat isn't accessible),
+// or a transient error is already retried by the request policy. Only network errors are retried
+func isVkSendingError(err error) bool {
+	var vkErr *api.Error
+	return errors.As(err, &vkErr)
+}
+
+func (outbox *Outbox) writeDeadLetter(message *OutgoingMessage, attempts int, err error) {
+	logging.Log.Error(logPackage, "Outbox.writeDeadLetter", err, "message %s isn't delivered after %d attempts: %v", message.ID, attempts, message.Params)
+	if len(outbox.deadLettersFile) == 0 {
+		return
+	}
+
+	line, marshalErr := json.Marshal(deadLetter{
+		Message:  message,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	})
+	if marshalErr != nil {
+		logging.Log.Error(logPackage, "Outbox.writeDeadLetter", marshalErr, "dead letter marshalling error")
+		return
+	}
+
+	file, openErr := os.OpenFile(outbox.deadLettersFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if openErr != nil {
+		logging.Log.Error(logPackage, "Outbox.writeDeadLetter", openErr, "%s: dead letters file opening error", outbox.deadLettersFile)
+		return
+	}
+	defer file.Close()
+
+	_, writeErr := file.Write(append(line, '\n'))
+	if writeErr != nil {
+		logging.Log.Error(logPackage, "Outbox.writeDeadLetter", writeErr, "%s: dead letters file writing error", outbox.deadLettersFile)
+	}
+}
+
+// persist rewrites the persistence file with all pending messages, must be called under the lock
+func (outbox *Outbox) persist() {
+	if len(outbox.persistenceFile) == 0 {
+		return
+	}
+
+	var messages []*OutgoingMessage
+	for _, queue := range outbox.queues {
+		messages = append(messages, queue...)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Seq < messages[j].Seq
+	})
+
+	content, err := json.Marshal(messages)
+	if err != nil {
+		logging.Log.Error(logPackage, "Outbox.persist", err, "pending messages marshalling error")
+		return
+	}
+
+	// the file is replaced at once, so it's not broken by a crash in the middle of writing
+	tmpFile := outbox.persistenceFile + ".tmp"
+	err = os.WriteFile(tmpFile, content, 0644)
+	if err == nil {
+		err = os.Rename(tmpFile, outbox.persistenceFile)
+	}
+	if err != nil {
+		logging.Log.Error(logPackage, "Outbox.persist", err, "%s: pending messages aren't saved", outbox.persistenceFile)
+	}
+}
+
+func (outbox *Outbox) restore() error {
+	if len(outbox.persistenceFile) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(outbox.persistenceFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var messages []*OutgoingMessage
+	err = json.Unmarshal(content, &messages)
+	if err != nil {
+		return fmt.Errorf("%s: pending messages unmarshalling error: %w", outbox.persistenceFile, err)
+	}
+
+	for _, message := range messages {
+		outbox.queues[message.PeerID] = append(outbox.queues[message.PeerID], message)
+		if message.Seq > outbox.seq {
+			outbox.seq = message.Seq
+		}
+	}
+
+	if len(messages) != 0 {
+		logging.Log.Info(logPackage, "Outbox.restore", "%d pending messages are restored", len(messages))
+	}
+	return nil
+}
+
+func formatParams(params api.Params) map[string]string {
+	if params == nil {
+		return nil
+	}
+
+	formatted := make(map[string]string, len(params))
+	for key, value := range params {
+		formatted[key] = api.FmtValue(value, 0)
+	}
+	return formatted
+}
+
+func parseParams(formatted map[string]string) api.Params {
+	params := make(api.Params, len(formatted))
+	for key, value := range formatted {
+		params[key] = value
+	}
+	return params
+}
@@ -0,0 +1,152 @@
+package vk
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type fakeMessagesApi struct {
+	mutex    sync.Mutex
+	failures map[string]int
+	sent     []api.Params
+	attempts []api.Params
+}
+
+func newFakeMessagesApi(failures map[string]int) (*api.VK, *fakeMessagesApi) {
+	fake := &fakeMessagesApi{failures: failures}
+	vkapi := api.NewVK("")
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+
+		message := params[0]
+		fake.attempts = append(fake.attempts, message)
+		text := message["message"].(string)
+		if fake.failures[text] > 0 {
+			fake.failures[text]--
+			return api.Response{}, errors.New("connection reset by peer")
+		}
+
+		fake.sent = append(fake.sent, message)
+		return api.Response{Response: []byte("1")}, nil
+	}
+	return vkapi, fake
+}
+
+func (fake *fakeMessagesApi) getSentTexts() []string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	var texts []string
+	for _, message := range fake.sent {
+		texts = append(texts, message["message"].(string))
+	}
+	return texts
+}
+
+func waitForSentMessages(fake *fakeMessagesApi, count int) []string {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && len(fake.getSentTexts()) < count {
+		time.Sleep(time.Millisecond)
+	}
+	return fake.getSentTexts()
+}
+
+func TestOutboxDeliversInOrderWithRetries(t *testing.T) {
+	vkapi, fake := newFakeMessagesApi(map[string]int{"first": 2})
+	outbox, _ := NewOutbox(vkapi, 0, 3, time.Millisecond, "", "")
+
+	_ = outbox.Enqueue(api.Params{"peer_id": 1, "message": "first"})
+	_ = outbox.Enqueue(api.Params{"peer_id": 1, "message": "second"})
+
+	expected := []string{"first", "second"}
+	actual := waitForSentMessages(fake, len(expected))
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+
+	// retries of a message are sent with the same random_id, so vk drops duplicates
+	if fake.attempts[0]["random_id"] != fake.attempts[2]["random_id"] || fake.attempts[2]["random_id"] == fake.attempts[3]["random_id"] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: the same random_id for retries of a message", fake.attempts)
+	}
+}
+
+func TestOutboxSendsFallbackOfUndeliveredMessage(t *testing.T) {
+	vkapi, fake := newFakeMessagesApi(map[string]int{"content": 10})
+	deadLettersFile := filepath.Join(t.TempDir(), "dead_letters.jsonl")
+	outbox, _ := NewOutbox(vkapi, 0, 2, time.Millisecond, "", deadLettersFile)
+
+	_ = outbox.EnqueueWithFallback(api.Params{"peer_id": 1, "message": "content"}, func() api.Params {
+		return api.Params{"peer_id": 1, "message": "retry"}
+	})
+
+	expected := []string{"retry"}
+	actual := waitForSentMessages(fake, len(expected))
+	if len(actual) != len(expected) || actual[0] != expected[0] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
+
+func TestOutboxDoesNotBuildFallbackOfDeliveredMessage(t *testing.T) {
+	vkapi, fake := newFakeMessagesApi(map[string]int{})
+	outbox, _ := NewOutbox(vkapi, 0, 2, time.Millisecond, "", "")
+
+	var fallbackBuilds int32
+	_ = outbox.EnqueueWithFallback(api.Params{"peer_id": 1, "message": "content"}, func() api.Params {
+		atomic.AddInt32(&fallbackBuilds, 1)
+		return api.Params{"peer_id": 1, "message": "retry"}
+	})
+
+	waitForSentMessages(fake, 1)
+	if atomic.LoadInt32(&fallbackBuilds) != 0 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", atomic.LoadInt32(&fallbackBuilds), 0)
+	}
+}
+
+func TestOutboxDoesNotRetryVkErrors(t *testing.T) {
+	vkapi := api.NewVK("")
+	attempts := 0
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		attempts++
+		return api.Response{}, &api.Error{Code: api.ErrServer}
+	}
+	outbox, _ := NewOutbox(vkapi, 0, 5, time.Millisecond, "", "")
+
+	outgoingMessage := &OutgoingMessage{ID: "1", PeerID: 1, Params: map[string]string{"peer_id": "1", "message": "first"}}
+	actualAttempts, err := outbox.send(outgoingMessage)
+	if err == nil || actualAttempts != 1 || attempts != 1 {
+		t.Errorf("Incorrect result. Actual: %v %v, Expected: %v %v", actualAttempts, err, 1, "vk error")
+	}
+}
+
+func TestOutboxRestoresPendingMessages(t *testing.T) {
+	persistenceFile := filepath.Join(t.TempDir(), "outbox.json")
+	vkapi, fake := newFakeMessagesApi(nil)
+
+	// the first outbox isn't started, like it's crashed before delivery
+	crashed, _ := NewOutbox(vkapi, 0, 1, time.Millisecond, persistenceFile, "")
+	crashed.mutex.Lock()
+	crashed.senders[1] = true
+	crashed.mutex.Unlock()
+	_ = crashed.Enqueue(api.Params{"peer_id": 1, "message": "first"})
+	_ = crashed.Enqueue(api.Params{"peer_id": 1, "message": "second"})
+
+	restarted, err := NewOutbox(vkapi, 0, 1, time.Millisecond, persistenceFile, "")
+	if err != nil {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", err, nil)
+		return
+	}
+	restarted.Start()
+
+	expected := []string{"first", "second"}
+	actual := waitForSentMessages(fake, len(expected))
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
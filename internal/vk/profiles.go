@@ -0,0 +1,241 @@
+package vk
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// UserProfileFields fields of a user profile which are fetched in addition to first_name and last_name,
+// so phrases could use them
+const UserProfileFields = "screen_name,sex,photo_100"
+
+// MaxUsersGetIDs https://dev.vk.com/method/users.get#user_ids parameters' constraints
+const MaxUsersGetIDs = 1000
+
+// GetUsers fetches profiles of users by batches of MaxUsersGetIDs
+func GetUsers(vkapi *api.VK, userIds []int) ([]object.UsersUser, error) {
+	var users []object.UsersUser
+	for start := 0; start < len(userIds); start += MaxUsersGetIDs {
+		end := start + MaxUsersGetIDs
+		if end > len(userIds) {
+			end = len(userIds)
+		}
+
+		ids := make([]string, 0, end-start)
+		for _, userId := range userIds[start:end] {
+			ids = append(ids, strconv.Itoa(userId))
+		}
+
+		batch, err := vkapi.UsersGet(api.Params{
+			"user_ids": strings.Join(ids, ","),
+			"fields":   UserProfileFields,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, batch...)
+	}
+
+	return users, nil
+}
+
+type cachedUserProfile struct {
+	user      object.UsersUser
+	expiresAt time.Time
+}
+
+// profilesBatch profiles which are fetched by one call, misses which happen while
+// the previous batch is being fetched are merged into the next one
+type profilesBatch struct {
+	userIds   []int
+	requested map[int]bool
+	done      chan struct{}
+	users     []object.UsersUser
+	err       error
+}
+
+// UserProfileCache keeps recently used user profiles, a profile expires after the ttl
+// and the least recently used one is evicted if the cache is full
+type UserProfileCache struct {
+	vkapi   *api.VK
+	ttl     time.Duration
+	maxSize int
+
+	mutex sync.Mutex
+	// the most recently used profiles are at the front
+	order    *list.List
+	profiles map[int]*list.Element
+
+	// a batch which waits for its fetching, and whether batches are being fetched
+	pendingBatch *profilesBatch
+	fetching     bool
+}
+
+func NewUserProfileCache(vkapi *api.VK, ttl time.Duration, maxSize int) *UserProfileCache {
+	return &UserProfileCache{
+		vkapi:    vkapi,
+		ttl:      ttl,
+		maxSize:  maxSize,
+		order:    list.New(),
+		profiles: make(map[int]*list.Element),
+	}
+}
+
+// Get returns a profile of a user, it's fetched if it isn't cached
+func (cache *UserProfileCache) Get(userId string) (*object.UsersUser, error) {
+	id, err := strconv.Atoi(userId)
+	if err != nil {
+		return nil, fmt.Errorf("user id `%s` is invalid: %w", userId, err)
+	}
+
+	users, err := cache.GetAll([]int{id})
+	if err != nil {
+		return nil, err
+	}
+
+	user, found := users[id]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("user with id `%s` not found", userId))
+	}
+
+	return &user, nil
+}
+
+// GetAll returns profiles of users by their ids, profiles which aren't cached are fetched by one batch
+func (cache *UserProfileCache) GetAll(userIds []int) (map[int]object.UsersUser, error) {
+	users := make(map[int]object.UsersUser, len(userIds))
+	var missingUserIds []int
+
+	cache.mutex.Lock()
+	now := time.Now()
+	for _, userId := range userIds {
+		if user, found := cache.get(userId, now); found {
+			users[userId] = user
+		} else {
+			missingUserIds = append(missingUserIds, userId)
+		}
+	}
+	cache.mutex.Unlock()
+
+	if len(missingUserIds) == 0 {
+		return users, nil
+	}
+
+	batch := cache.enqueueMisses(missingUserIds)
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+
+	requested := make(map[int]bool, len(missingUserIds))
+	for _, userId := range missingUserIds {
+		requested[userId] = true
+	}
+	for _, user := range batch.users {
+		if requested[user.ID] {
+			users[user.ID] = user
+		}
+	}
+
+	return users, nil
+}
+
+// enqueueMisses adds user ids to the pending batch, so concurrent misses are fetched by one call
+func (cache *UserProfileCache) enqueueMisses(userIds []int) *profilesBatch {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.pendingBatch == nil {
+		cache.pendingBatch = &profilesBatch{
+			requested: make(map[int]bool),
+			done:      make(chan struct{}),
+		}
+	}
+
+	batch := cache.pendingBatch
+	for _, userId := range userIds {
+		if !batch.requested[userId] {
+			batch.requested[userId] = true
+			batch.userIds = append(batch.userIds, userId)
+		}
+	}
+
+	if !cache.fetching {
+		cache.fetching = true
+		go cache.fetchPendingBatches()
+	}
+
+	return batch
+}
+
+// fetchPendingBatches fetches batches one by one until there's no pending one
+func (cache *UserProfileCache) fetchPendingBatches() {
+	for {
+		cache.mutex.Lock()
+		batch := cache.pendingBatch
+		cache.pendingBatch = nil
+		if batch == nil {
+			cache.fetching = false
+			cache.mutex.Unlock()
+			return
+		}
+		cache.mutex.Unlock()
+
+		batch.users, batch.err = GetUsers(cache.vkapi, batch.userIds)
+		if batch.err == nil {
+			cache.Put(batch.users...)
+		}
+		close(batch.done)
+	}
+}
+
+// Put caches profiles which are already fetched (e.g. with members of a conversation)
+func (cache *UserProfileCache) Put(users ...object.UsersUser) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	expiresAt := time.Now().Add(cache.ttl)
+	for _, user := range users {
+		if element, found := cache.profiles[user.ID]; found {
+			element.Value = &cachedUserProfile{user: user, expiresAt: expiresAt}
+			cache.order.MoveToFront(element)
+			continue
+		}
+
+		cache.profiles[user.ID] = cache.order.PushFront(&cachedUserProfile{user: user, expiresAt: expiresAt})
+		if cache.maxSize > 0 && cache.order.Len() > cache.maxSize {
+			cache.remove(cache.order.Back())
+		}
+	}
+}
+
+// get returns a profile which isn't expired, must be called under the lock
+func (cache *UserProfileCache) get(userId int, now time.Time) (object.UsersUser, bool) {
+	element, found := cache.profiles[userId]
+	if !found {
+		return object.UsersUser{}, false
+	}
+
+	profile := element.Value.(*cachedUserProfile)
+	if now.After(profile.expiresAt) {
+		cache.remove(element)
+		return object.UsersUser{}, false
+	}
+
+	cache.order.MoveToFront(element)
+	return profile.user, true
+}
+
+func (cache *UserProfileCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.profiles, element.Value.(*cachedUserProfile).user.ID)
+}
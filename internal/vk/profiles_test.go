@@ -0,0 +1,124 @@
+package vk
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+func newFakeUsersApi(requestedIds *[]string) *api.VK {
+	vkapi := api.NewVK("")
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		userIds := params[0]["user_ids"].(string)
+		*requestedIds = append(*requestedIds, userIds)
+
+		var users []string
+		for _, userId := range strings.Split(userIds, ",") {
+			users = append(users, fmt.Sprintf(`{"id":%s,"screen_name":"id%s"}`, userId, userId))
+		}
+		return api.Response{Response: []byte("[" + strings.Join(users, ",") + "]")}, nil
+	}
+	return vkapi
+}
+
+func TestUserProfileCacheFetchesMissingProfilesByOneBatch(t *testing.T) {
+	var requestedIds []string
+	cache := NewUserProfileCache(newFakeUsersApi(&requestedIds), time.Hour, 10)
+	cache.Put(object.UsersUser{ID: 1, ScreenName: "prefilled"})
+
+	users, _ := cache.GetAll([]int{1, 2, 3})
+	if len(users) != 3 || users[1].ScreenName != "prefilled" || users[3].ScreenName != "id3" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", users, "3 users with the prefilled one")
+	}
+
+	expected := []string{"2,3"}
+	if len(requestedIds) != len(expected) || requestedIds[0] != expected[0] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", requestedIds, expected)
+	}
+
+	_, _ = cache.Get("2")
+	if len(requestedIds) != len(expected) {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", requestedIds, expected)
+	}
+}
+
+func TestUserProfileCacheEvictsLeastRecentlyUsedAndExpiredProfiles(t *testing.T) {
+	var requestedIds []string
+	cache := NewUserProfileCache(newFakeUsersApi(&requestedIds), time.Hour, 2)
+	cache.Put(object.UsersUser{ID: 1}, object.UsersUser{ID: 2})
+	_, _ = cache.Get("1")
+	cache.Put(object.UsersUser{ID: 3})
+
+	_, _ = cache.GetAll([]int{1, 3})
+	if len(requestedIds) != 0 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", requestedIds, []string{})
+	}
+
+	_, _ = cache.Get("2")
+	if len(requestedIds) != 1 || requestedIds[0] != "2" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", requestedIds, []string{"2"})
+	}
+
+	expiringCache := NewUserProfileCache(newFakeUsersApi(&requestedIds), -time.Second, 2)
+	expiringCache.Put(object.UsersUser{ID: 4})
+	_, _ = expiringCache.Get("4")
+	if len(requestedIds) != 2 || requestedIds[1] != "4" {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", requestedIds, []string{"2", "4"})
+	}
+}
+
+func TestUserProfileCacheMergesConcurrentMisses(t *testing.T) {
+	var requestedIds []string
+	firstCallStarted := make(chan struct{})
+	releaseFirstCall := make(chan struct{})
+	vkapi := newFakeUsersApi(&requestedIds)
+	handler := vkapi.Handler
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		if len(requestedIds) == 0 {
+			close(firstCallStarted)
+			<-releaseFirstCall
+		}
+		return handler(method, params...)
+	}
+	cache := NewUserProfileCache(vkapi, time.Hour, 10)
+
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		_, _ = cache.Get("1")
+	}()
+	<-firstCallStarted
+
+	// misses during the first call are fetched together by the next one
+	for userId := 2; userId <= 4; userId++ {
+		waitGroup.Add(1)
+		go func(userId int) {
+			defer waitGroup.Done()
+			_, _ = cache.GetAll([]int{userId})
+		}(userId)
+	}
+	for {
+		cache.mutex.Lock()
+		pendingUserIds := 0
+		if cache.pendingBatch != nil {
+			pendingUserIds = len(cache.pendingBatch.userIds)
+		}
+		cache.mutex.Unlock()
+		if pendingUserIds == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(releaseFirstCall)
+	waitGroup.Wait()
+
+	if len(requestedIds) != 2 || requestedIds[0] != "1" || len(strings.Split(requestedIds[1], ",")) != 3 {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", requestedIds, "1 and then 3 other ids by one call")
+	}
+}
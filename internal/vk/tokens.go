@@ -0,0 +1,256 @@
+package vk
+
+import (
+	"chattweiler/internal/configs"
+	"chattweiler/internal/logging"
+	"chattweiler/internal/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// a period for which a token is parked after transient errors (e.g. "too many requests per second")
+const transientErrorParkingPeriod = time.Second
+
+var ErrNoAvailableTokens = errors.New("there's no available tokens in the pool")
+
+type pooledToken struct {
+	value       string
+	parkedUntil time.Time
+	invalidated bool
+	requests    int
+	failures    int
+	lastError   error
+}
+
+// TokenHealth a snapshot of a token's state in a pool
+type TokenHealth struct {
+	// masked token value, so it's safe to log it
+	Token       string
+	Available   bool
+	Invalidated bool
+	ParkedUntil time.Time
+	Requests    int
+	Failures    int
+	LastError   error
+}
+
+func (health TokenHealth) String() string {
+	status := "available"
+	if health.Invalidated {
+		status = "invalidated"
+	} else if !health.Available {
+		status = "parked until " + health.ParkedUntil.Format(time.RFC3339)
+	}
+
+	return fmt.Sprintf("%s: %s, requests=%d, failures=%d, last error=%v", health.Token, status, health.Requests, health.Failures, health.LastError)
+}
+
+// TokenPool rotates tokens round-robin for api calls.
+// A token is parked for a while if it's rate-limited or a call is failed by a transient error (errors 6, 9, 10, 29),
+// or is taken out of rotation if it's invalidated (error 5), and a call is repeated with the next token
+type TokenPool struct {
+	mutex                  sync.Mutex
+	tokens                 []*pooledToken
+	nextTokenIndex         int
+	rateLimitParkingPeriod time.Duration
+}
+
+func NewTokenPool(tokens []string, rateLimitParkingPeriod time.Duration) *TokenPool {
+	pool := &TokenPool{
+		rateLimitParkingPeriod: rateLimitParkingPeriod,
+	}
+
+	// a token is kept once, so it isn't used more often than others and is parked or invalidated entirely
+	// (e.g. the same token is set in both vk.admin.user.tokens and legacy vk.admin.user.token)
+	addedTokens := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); len(token) != 0 && !addedTokens[token] {
+			addedTokens[token] = true
+			pool.tokens = append(pool.tokens, &pooledToken{value: token})
+		}
+	}
+
+	return pool
+}
+
+// NewUserTokenPool creates a pool of admin user tokens from configurations
+func NewUserTokenPool() (*TokenPool, error) {
+	parkingPeriod, err := time.ParseDuration(utils.GetEnvOrDefault(configs.VkAdminUserTokenParkingPeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := strings.Split(utils.GetEnvOrDefault(configs.VkAdminUserTokens), ",")
+	tokens = append(tokens, utils.GetEnvOrDefault(configs.VkAdminUserToken))
+	return NewTokenPool(tokens, parkingPeriod), nil
+}
+
+func (pool *TokenPool) IsEmpty() bool {
+	return len(pool.tokens) == 0
+}
+
+// NewVK creates an api client which calls go through the pool, every token is limited by the policy
+func (pool *TokenPool) NewVK(policy RequestPolicy) *api.VK {
+	if pool.IsEmpty() {
+		return WithRequestPolicy(api.NewVK(""), policy)
+	}
+
+	tokens := make([]string, len(pool.tokens))
+	for index, token := range pool.tokens {
+		tokens[index] = token.value
+	}
+
+	vkapi := WithRequestPolicy(api.NewVK(tokens...), policy)
+	limitedHandler := vkapi.Handler
+	vkapi.Handler = func(method string, params ...api.Params) (api.Response, error) {
+		return pool.handle(limitedHandler, method, params...)
+	}
+
+	return vkapi
+}
+
+func (pool *TokenPool) handle(
+	handler func(method string, params ...api.Params) (api.Response, error),
+	method string,
+	params ...api.Params,
+) (api.Response, error) {
+	var lastResponse api.Response
+	var lastErr error
+	for attempt := 0; attempt < len(pool.tokens); attempt++ {
+		token := pool.acquire()
+		if token == nil {
+			break
+		}
+
+		// the latest params override the token chosen by the client
+		tokenParams := append(append([]api.Params{}, params...), api.Params{"access_token": token.value})
+		lastResponse, lastErr = handler(method, tokenParams...)
+		if !pool.release(token, lastErr) {
+			return lastResponse, lastErr
+		}
+	}
+
+	if lastErr != nil {
+		return lastResponse, lastErr
+	}
+
+	return api.Response{}, ErrNoAvailableTokens
+}
+
+func (pool *TokenPool) acquire() *pooledToken {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	now := time.Now()
+	for checked := 0; checked < len(pool.tokens); checked++ {
+		token := pool.tokens[pool.nextTokenIndex]
+		pool.nextTokenIndex = (pool.nextTokenIndex + 1) % len(pool.tokens)
+		if !token.invalidated && now.After(token.parkedUntil) {
+			token.requests++
+			return token
+		}
+	}
+
+	return nil
+}
+
+// release registers a result of a call and tells whether the call should be repeated with another token
+func (pool *TokenPool) release(token *pooledToken, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	token.failures++
+	token.lastError = err
+
+	switch ClassifyError(err) {
+	case AuthErrorKind:
+		token.invalidated = true
+		logging.Log.Error(logPackage, "TokenPool.release", err, "token %s is invalidated and taken out of rotation", maskToken(token.value))
+	case RateLimitedErrorKind:
+		token.parkedUntil = time.Now().Add(pool.rateLimitParkingPeriod)
+		logging.Log.Warn(logPackage, "TokenPool.release", "token %s is rate-limited and parked until %s", maskToken(token.value), token.parkedUntil.Format(time.RFC3339))
+	case TransientErrorKind:
+		token.parkedUntil = time.Now().Add(transientErrorParkingPeriod)
+	default:
+		return false
+	}
+
+	pool.logHealth()
+	return true
+}
+
+// Health returns states of all tokens in the pool
+func (pool *TokenPool) Health() []TokenHealth {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return pool.health()
+}
+
+// LoopLogHealth logs a summary of tokens' states periodically, so parked and invalidated tokens are noticed while the bot runs
+func (pool *TokenPool) LoopLogHealth(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		logging.Log.Info(logPackage, "TokenPool.LoopLogHealth", "%s", summarizeHealth(pool.Health()))
+	}
+}
+
+// summarizeHealth describes states of tokens in one line (e.g. "2 available, 1 parked, 0 invalidated: ...")
+func summarizeHealth(health []TokenHealth) string {
+	available, parked, invalidated := 0, 0, 0
+	descriptions := make([]string, len(health))
+	for index, tokenHealth := range health {
+		switch {
+		case tokenHealth.Invalidated:
+			invalidated++
+		case !tokenHealth.Available:
+			parked++
+		default:
+			available++
+		}
+		descriptions[index] = tokenHealth.String()
+	}
+
+	return fmt.Sprintf("%d available, %d parked, %d invalidated: %s", available, parked, invalidated, strings.Join(descriptions, "; "))
+}
+
+func (pool *TokenPool) logHealth() {
+	for _, health := range pool.health() {
+		logging.Log.Info(logPackage, "TokenPool.logHealth", "%s", health)
+	}
+}
+
+func (pool *TokenPool) health() []TokenHealth {
+	now := time.Now()
+	health := make([]TokenHealth, len(pool.tokens))
+	for index, token := range pool.tokens {
+		health[index] = TokenHealth{
+			Token:       maskToken(token.value),
+			Available:   !token.invalidated && now.After(token.parkedUntil),
+			Invalidated: token.invalidated,
+			ParkedUntil: token.parkedUntil,
+			Requests:    token.requests,
+			Failures:    token.failures,
+			LastError:   token.lastError,
+		}
+	}
+
+	return health
+}
+
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "***"
+	}
+
+	return token[:4] + "..." + token[len(token)-4:]
+}
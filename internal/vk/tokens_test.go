@@ -0,0 +1,112 @@
+package vk
+
+import (
+	"chattweiler/internal/configs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+func TestTokenPoolRotation(t *testing.T) {
+	pool := NewTokenPool([]string{"first", "second"}, time.Hour)
+
+	var usedTokens []string
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		usedTokens = append(usedTokens, params[len(params)-1]["access_token"].(string))
+		return api.Response{}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		_, _ = pool.handle(handler, "wall.get")
+	}
+
+	expected := []string{"first", "second", "first"}
+	for index := range expected {
+		if usedTokens[index] != expected[index] {
+			t.Errorf("Incorrect result. Actual: %v, Expected: %v", usedTokens, expected)
+		}
+	}
+}
+
+func TestTokenPoolParksRateLimitedToken(t *testing.T) {
+	pool := NewTokenPool([]string{"limited", "healthy"}, time.Hour)
+
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		if params[len(params)-1]["access_token"] == "limited" {
+			return api.Response{}, &api.Error{Code: api.ErrRateLimit}
+		}
+		return api.Response{}, nil
+	}
+
+	_, err := pool.handle(handler, "wall.get")
+	if err != nil {
+		t.Errorf("Call is expected to be repeated with a healthy token, but got: %v", err)
+	}
+
+	health := pool.Health()
+	if health[0].Available || !health[1].Available {
+		t.Errorf("Only the rate-limited token is expected to be parked: %v", health)
+	}
+}
+
+func TestSummarizeHealth(t *testing.T) {
+	health := []TokenHealth{
+		{Token: "aaaa...aaaa", Available: true},
+		{Token: "bbbb...bbbb", ParkedUntil: time.Date(2022, 10, 31, 9, 0, 0, 0, time.UTC)},
+		{Token: "cccc...cccc", Invalidated: true},
+	}
+
+	expected := "1 available, 1 parked, 0 invalidated"
+	actual := summarizeHealth(health[:2])
+	if !strings.HasPrefix(actual, expected) || !strings.Contains(actual, "bbbb...bbbb: parked until 2022-10-31T09:00:00Z") {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+
+	expected = "1 available, 1 parked, 1 invalidated"
+	if actual = summarizeHealth(health); !strings.HasPrefix(actual, expected) {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
+
+func TestTokenPoolInvalidatesToken(t *testing.T) {
+	pool := NewTokenPool([]string{"expired"}, time.Hour)
+
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		return api.Response{}, &api.Error{Code: api.ErrAuth}
+	}
+
+	_, err := pool.handle(handler, "audio.get")
+	if err == nil {
+		t.Errorf("Error is expected when all tokens are invalidated")
+	}
+
+	_, err = pool.handle(handler, "audio.get")
+	if err != ErrNoAvailableTokens {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", err, ErrNoAvailableTokens)
+	}
+
+	if !pool.Health()[0].Invalidated {
+		t.Errorf("Token is expected to be invalidated")
+	}
+}
+
+func TestUserTokenPoolKeepsTokenOnce(t *testing.T) {
+	t.Setenv(configs.VkAdminUserTokens.Key, "first, second,first")
+	t.Setenv(configs.VkAdminUserToken.Key, "second")
+
+	pool, err := NewUserTokenPool()
+	if err != nil {
+		t.Fatalf("Incorrect result. Actual: %v, Expected: %v", err, nil)
+	}
+
+	var actual []string
+	for _, token := range pool.tokens {
+		actual = append(actual, token.value)
+	}
+	expected := []string{"first", "second"}
+	if len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] {
+		t.Errorf("Incorrect result. Actual: %v, Expected: %v", actual, expected)
+	}
+}
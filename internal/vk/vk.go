@@ -3,6 +3,8 @@ package vk
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/SevereCloud/vksdk/v2/api"
 	"github.com/SevereCloud/vksdk/v2/object"
@@ -19,27 +21,51 @@ const (
 	DocumentType MediaAttachmentType = "doc"
 )
 
-func GetUserInfo(vkapi *api.VK, userID string) (*object.UsersUser, error) {
-	users, err := vkapi.UsersGet(api.Params{
-		"user_ids": userID,
-		"fields":   "screen_name",
+func GetWallPostsCount(vkapi *api.VK, community string) (int, error) {
+	response, err := vkapi.WallGet(api.Params{
+		"domain": community,
+		"count":  1,
 	})
 
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	if len(users) == 0 {
-		return nil, errors.New(fmt.Sprintf("user with id `%s` not found", userID))
+	return response.Count, nil
+}
+
+// AudioGetResponse struct.
+//
+// https://dev.vk.com/method/audio.get (the method is not present in the sdk)
+type AudioGetResponse struct {
+	Count int                 `json:"count"`
+	Items []object.AudioAudio `json:"items"`
+}
+
+func AudioGet(vkapi *api.VK, params api.Params) (response AudioGetResponse, err error) {
+	err = vkapi.RequestUnmarshal("audio.get", &response, params)
+	return
+}
+
+func GetPhotoAlbumSize(vkapi *api.VK, ownerID int, albumID string) (int, error) {
+	response, err := vkapi.PhotosGet(api.Params{
+		"owner_id": ownerID,
+		"album_id": albumID,
+		"count":    1,
+	})
+
+	if err != nil {
+		return 0, err
 	}
 
-	return &users[0], err
+	return response.Count, nil
 }
 
-func GetWallPostsCount(vkapi *api.VK, community string) (int, error) {
-	response, err := vkapi.WallGet(api.Params{
-		"domain": community,
-		"count":  1,
+func GetVideoAlbumSize(vkapi *api.VK, ownerID int, albumID string) (int, error) {
+	response, err := vkapi.VideoGet(api.Params{
+		"owner_id": ownerID,
+		"album_id": albumID,
+		"count":    1,
 	})
 
 	if err != nil {
@@ -48,3 +74,71 @@ func GetWallPostsCount(vkapi *api.VK, community string) (int, error) {
 
 	return response.Count, nil
 }
+
+func GetAudioPlaylistSize(vkapi *api.VK, ownerID int, playlistID string) (int, error) {
+	response, err := AudioGet(vkapi, api.Params{
+		"owner_id":    ownerID,
+		"playlist_id": playlistID,
+		"count":       1,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Count, nil
+}
+
+func GetCommunityName(vkapi *api.VK, communityID int) (string, error) {
+	communities, err := vkapi.GroupsGetByID(api.Params{
+		"group_id": communityID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(communities) == 0 {
+		return "", errors.New(fmt.Sprintf("community with id `%d` not found", communityID))
+	}
+
+	return communities[0].Name, nil
+}
+
+func GetCommunities(vkapi *api.VK, communityIDs []int64) ([]object.GroupsGroup, error) {
+	ids := make([]string, len(communityIDs))
+	for index, communityID := range communityIDs {
+		ids[index] = strconv.FormatInt(communityID, 10)
+	}
+
+	return vkapi.GroupsGetByID(api.Params{
+		"group_ids": strings.Join(ids, ","),
+	})
+}
+
+// MaxConversationMembersPage https://dev.vk.com/method/messages.getConversationMembers#count parameters' constraints
+const MaxConversationMembersPage = 200
+
+// GetAllConversationMembers fetches members of a conversation page by page, profiles of users have UserProfileFields
+func GetAllConversationMembers(vkapi *api.VK, peerID int64) (api.MessagesGetConversationMembersResponse, error) {
+	var members api.MessagesGetConversationMembersResponse
+	for offset := 0; ; offset += MaxConversationMembersPage {
+		page, err := vkapi.MessagesGetConversationMembers(api.Params{
+			"peer_id": peerID,
+			"offset":  offset,
+			"count":   MaxConversationMembersPage,
+			"fields":  UserProfileFields,
+		})
+		if err != nil {
+			return members, err
+		}
+
+		members.Count = page.Count
+		members.Items = append(members.Items, page.Items...)
+		members.Profiles = append(members.Profiles, page.Profiles...)
+		members.Groups = append(members.Groups, page.Groups...)
+		if len(page.Items) == 0 || offset+MaxConversationMembersPage >= page.Count {
+			return members, nil
+		}
+	}
+}